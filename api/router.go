@@ -1,30 +1,83 @@
 package api
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"fmt"
 	"net/http"
-	"net/http/httputil"
 	"qnhd/api/v1/backend"
 	"qnhd/api/v1/frontend"
 	"qnhd/middleware/crossfield"
 	"qnhd/middleware/safety"
+	"qnhd/pkg/avatar"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/setting"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 var s *http.Server
 
-func avatarReverse(c *gin.Context) {
-	realPath := c.Param("p")
-	director := func(req *http.Request) {
-		req.URL.Scheme = "http"
-		req.URL.Host = "127.0.0.1:7014"
-		req.URL.Path = realPath
+var avatarCache = avatar.NewCache(1024)
+
+// 头像地址格式与boring-avatars一致: /avatar/:variant/:size/:name?colors=&square
+// 匿名作者以帖子、楼层中返回的加密uid作为name，同一帖子内头像一致
+func avatarHandler(c *gin.Context) {
+	parts := strings.Split(strings.Trim(c.Param("p"), "/"), "/")
+	o := avatar.Options{Variant: avatar.BEAM, Size: avatar.DEFAULT_SIZE}
+	switch len(parts) {
+	case 3:
+		o.Name = parts[2]
+		fallthrough
+	case 2:
+		size, err := strconv.Atoi(parts[1])
+		if err != nil || size <= 0 {
+			c.String(http.StatusBadRequest, "头像尺寸错误")
+			return
+		}
+		if size > avatar.MAX_SIZE {
+			size = avatar.MAX_SIZE
+		}
+		o.Size = size
+		fallthrough
+	case 1:
+		o.Variant = parts[0]
+	default:
+		c.String(http.StatusNotFound, "")
+		return
+	}
+	if o.Variant == "" {
+		o.Variant = avatar.BEAM
+	}
+	if !avatar.IsValidVariant(o.Variant) {
+		c.String(http.StatusBadRequest, "头像样式错误")
+		return
+	}
+	colors, err := avatar.ParseColors(c.Query("colors"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	o.Colors = colors
+	_, o.Square = c.GetQuery("square")
+
+	key := fmt.Sprintf("%s/%d/%s/%s/%t", o.Variant, o.Size, o.Name, strings.Join(o.Colors, ","), o.Square)
+	sum := md5.Sum([]byte(key))
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	svg, ok := avatarCache.Get(key)
+	if !ok {
+		svg = avatar.Render(o)
+		avatarCache.Add(key, svg)
 	}
-	proxy := &httputil.ReverseProxy{Director: director}
-	proxy.ServeHTTP(c.Writer, c.Request)
+	c.Data(http.StatusOK, "image/svg+xml", []byte(svg))
 }
 
 func initRouter() (r *gin.Engine) {
@@ -38,8 +91,8 @@ func initRouter() (r *gin.Engine) {
 	r.Use(crossfield.CrossField())
 	// 解决安全问题
 	r.Use(safety.Safety())
-	// 头像服务转发
-	r.GET("/avatar/*p", avatarReverse)
+	// 头像服务
+	r.GET("/avatar/*p", avatarHandler)
 
 	avb := r.Group("/api/v1/b")
 	backend.Setup(avb)
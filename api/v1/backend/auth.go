@@ -1,12 +1,12 @@
 package backend
 
 import (
+	"errors"
 	"qnhd/api/v1/common"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/r"
-	"qnhd/pkg/util"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/gin-gonic/gin"
@@ -29,41 +29,15 @@ func GetAuth(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	user, err := chainAuth(
-		map[string]interface{}{
-			"nickname": nickname,
-			"password": password,
-			"is_user":  false,
-		},
-		map[string]interface{}{
-			"number":   nickname,
-			"password": password,
-			"is_user":  false,
-		},
-		map[string]interface{}{
-			"phone_number": nickname,
-			"password":     password,
-			"is_user":      false,
-		},
-	)
+	user, err := models.CheckAdminLogin(nickname, password)
 	if err != nil {
 		logging.Error("check admin error:%v", err)
-	}
-	auth(c, user)
-}
-
-func chainAuth(maps ...map[string]interface{}) (models.User, error) {
-	var (
-		u models.User
-		e error
-	)
-	for _, m := range maps {
-		u, e = models.GetUser(m)
-		if e == nil {
-			return u, nil
+		if errors.Is(err, models.ErrPasswordLocked) {
+			r.Error(c, e.ERROR_AUTH_LOCKED, err.Error())
+			return
 		}
 	}
-	return u, e
+	auth(c, user)
 }
 
 func auth(c *gin.Context, user models.User) {
@@ -71,12 +45,16 @@ func auth(c *gin.Context, user models.User) {
 	data := make(map[string]interface{})
 	if user.Uid > 0 {
 		// tag = 0 means ADMIN
-		token, err := util.GenerateToken(util.AsStrU(user.Uid))
-		if err != nil {
+		if err := common.IssueToken(c, user.Uid, data); errors.Is(err, models.ErrTotpRequired) {
+			code = e.ERROR_TOTP_REQUIRED
+		} else if err != nil {
 			code = e.ERROR_GENERATE_TOKEN
 		} else {
-			data["token"] = token
 			data["user"] = user
+			// 重置过密码需要先修改
+			data["must_change_password"] = user.MustChangePassword
+			// 角色要求两步验证但还没有开启
+			data["totp_enroll_required"] = models.IsTotpRequired(user.Uid)
 			code = e.SUCCESS
 		}
 	} else {
@@ -103,11 +81,47 @@ func GetAuthPasswd(c *gin.Context) {
 	common.GetAuthPasswd(c)
 }
 
+// @method [post]
+// @way [formdata]
+// @param refresh_token
+// @return token, refresh_token
+// @route /b/auth/refresh
+func RefreshSession(c *gin.Context) {
+	common.RefreshToken(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param totp_token, code 验证码或恢复码
+// @return token, refresh_token
+// @route /b/auth/totp/login
+func LoginTotp(c *gin.Context) {
+	common.LoginTotp(c)
+}
+
 // @method [get]
 // @way [query]
-// @param token
-// @return token
-// @route /b/auth/:token
-func RefreshToken(c *gin.Context) {
-	common.RefreshToken(c)
+// @param
+// @return list
+// @route /b/auth/sessions
+func GetSessions(c *gin.Context) {
+	common.GetSessions(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param id 不传时注销当前会话
+// @return
+// @route /b/auth/logout
+func Logout(c *gin.Context) {
+	common.Logout(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param keep_current
+// @return
+// @route /b/auth/logout/all
+func LogoutAll(c *gin.Context) {
+	common.LogoutAll(c)
 }
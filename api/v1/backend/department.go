@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"qnhd/enums/PermissionType"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
@@ -91,7 +92,7 @@ func EditDepartment(c *gin.Context) {
 		return
 	}
 	// 校管或者超管
-	if !models.RequireRight(uid, models.UserRight{Super: true}) {
+	if !models.HasPermissionIn(uid, PermissionType.DEPARTMENT_MANAGE, models.Scope{DepartmentId: util.AsUint(departmentId)}) {
 		hasRight := models.IsDepartmentHasUser(util.AsUint(uid), util.AsUint(departmentId))
 		if !hasRight {
 			r.OK(c, e.ERROR_RIGHT, nil)
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"qnhd/enums/PermissionType"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
@@ -146,7 +147,24 @@ func DeleteFloor(c *gin.Context) {
 		return
 	}
 
-	_, err := models.DeleteFloorByAdmin(uid, floorId)
+	floor, err := models.GetFloor(floorId)
+	if err != nil {
+		logging.Error("Delete floor error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	post, err := models.GetPost(util.AsStrU(floor.PostId))
+	if err != nil {
+		logging.Error("Delete floor error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	// 角色限定了范围时只能删除范围内的楼层
+	if !models.HasPermissionIn(uid, PermissionType.FLOOR_DELETE, models.PostScope(post)) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return
+	}
+	_, err = models.DeleteFloorByAdmin(uid, floorId)
 	if err != nil {
 		logging.Error("Delete floor error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -172,7 +190,11 @@ func RecoverFloor(c *gin.Context) {
 		return
 	}
 
-	err := models.RecoverFloor(floorId)
+	scope, err := models.FloorScopeById(util.AsUint(floorId))
+	if !demandScope(c, PermissionType.FLOOR_RECOVER, scope, err) {
+		return
+	}
+	err = models.RecoverFloor(floorId)
 	if err != nil {
 		logging.Error("Recover floor error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -0,0 +1,98 @@
+package backend
+
+import (
+	"qnhd/enums/PermissionType"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param status 0待审核 1已通过 2已拒绝，不传为全部
+// @return
+// @route /b/held_contents
+func GetHeldContents(c *gin.Context) {
+	status := c.Query("status")
+	valid := validation.Validation{}
+	valid.Numeric(status, "status")
+	ok, verr := r.ErrorValid(&valid, "Get held contents")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	list, err := models.GetHeldContents(c, status)
+	if err != nil {
+		logging.Error("Get held contents error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param id
+// @return
+// @route /b/held_content/approve
+func ApproveHeldContent(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.PostForm("id")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	ok, verr := r.ErrorValid(&valid, "Approve held content")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	scope, err := models.HeldContentScope(util.AsUint(id))
+	if !demandScope(c, PermissionType.POST_MODERATE, scope, err) {
+		return
+	}
+	objectId, err := models.ApproveHeldContent(uid, id)
+	if err != nil {
+		logging.Error("Approve held content error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	data := make(map[string]interface{})
+	data["id"] = objectId
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param id
+// @return
+// @route /b/held_content/reject
+func RejectHeldContent(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.PostForm("id")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	ok, verr := r.ErrorValid(&valid, "Reject held content")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	scope, err := models.HeldContentScope(util.AsUint(id))
+	if !demandScope(c, PermissionType.POST_MODERATE, scope, err) {
+		return
+	}
+	if err := models.RejectHeldContent(uid, id); err != nil {
+		logging.Error("Reject held content error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
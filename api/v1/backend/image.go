@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"qnhd/enums/PermissionType"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [post]
+// @way [formdata]
+// @param url, reason
+// @return
+// @route /b/image/takedown
+func TakeDownImage(c *gin.Context) {
+	uid := r.GetUid(c)
+	url := c.PostForm("url")
+	reason := c.PostForm("reason")
+	valid := validation.Validation{}
+	valid.Required(url, "url")
+	valid.Required(reason, "reason")
+	valid.MaxSize(reason, 100, "reason")
+	ok, verr := r.ErrorValid(&valid, "Take down image")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	// 图片可能出现在多个范围内，只有不限范围的角色可以下架
+	if !models.HasPermissionIn(uid, PermissionType.POST_MODERATE, models.Scope{}) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return
+	}
+	if err := models.TakeDownImage(uid, url, reason); err != nil {
+		logging.Error("Take down image error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
@@ -1,16 +1,105 @@
 package backend
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"qnhd/enums/PostCampusType"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/r"
+	"qnhd/pkg/template"
 	"qnhd/pkg/util"
+	"regexp"
+	"strings"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-module/carbon/v2"
 )
 
+// 从表单中解析通知受众
+func parseNoticeAudience(c *gin.Context) (models.NoticeAudience, error) {
+	var audience models.NoticeAudience
+	campus := c.PostFormArray("campus")
+	postTypes := c.PostFormArray("post_types")
+	departmentIds := c.PostFormArray("department_ids")
+	uids := c.PostFormArray("uids")
+	audience.Numbers = c.PostFormArray("numbers")
+	audience.Role = c.PostForm("role")
+	audience.RegisteredFrom = c.PostForm("registered_from")
+	audience.RegisteredTo = c.PostForm("registered_to")
+
+	valid := validation.Validation{}
+	for _, v := range campus {
+		valid.Numeric(v, "campus")
+	}
+	for _, v := range postTypes {
+		valid.Numeric(v, "post_types")
+	}
+	for _, v := range departmentIds {
+		valid.Numeric(v, "department_ids")
+	}
+	for _, v := range uids {
+		valid.Numeric(v, "uids")
+	}
+	if audience.Role != "" {
+		valid.Match(audience.Role, regexpAudienceRole, "role")
+	}
+	ok, verr := r.ErrorValid(&valid, "Notice audience")
+	if !ok {
+		return audience, verr
+	}
+	for _, v := range campus {
+		ci := util.AsInt(v)
+		valid.Range(ci, 0, 2, "campus")
+		audience.Campus = append(audience.Campus, PostCampusType.Enum(ci))
+	}
+	ok, verr = r.ErrorValid(&valid, "Notice audience")
+	if !ok {
+		return audience, verr
+	}
+	for _, v := range postTypes {
+		audience.PostTypes = append(audience.PostTypes, util.AsInt(v))
+	}
+	for _, v := range departmentIds {
+		audience.DepartmentIds = append(audience.DepartmentIds, util.AsUint(v))
+	}
+	for _, v := range uids {
+		audience.Uids = append(audience.Uids, util.AsUint(v))
+	}
+	if audience.RegisteredFrom != "" && carbon.Parse(audience.RegisteredFrom).Error != nil {
+		return audience, fmt.Errorf("时间格式应为YYYY-MM-dd hh:mm:ss")
+	}
+	if audience.RegisteredTo != "" && carbon.Parse(audience.RegisteredTo).Error != nil {
+		return audience, fmt.Errorf("时间格式应为YYYY-MM-dd hh:mm:ss")
+	}
+	// 上传的学号名单，一行一个
+	if fh, err := c.FormFile("numbers_file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return audience, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if n := strings.TrimSpace(scanner.Text()); n != "" {
+				audience.Numbers = append(audience.Numbers, n)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return audience, err
+		}
+	}
+	audience.Numbers = util.SetString(audience.Numbers)
+	audience.Uids = util.SetUint64(audience.Uids)
+	return audience, nil
+}
+
+var regexpAudienceRole = regexp.MustCompile(fmt.Sprintf("^(%s|%s|%s)$",
+	models.AUDIENCE_ROLE_USER, models.AUDIENCE_ROLE_MANAGER, models.AUDIENCE_ROLE_ALL))
+
 // @method [get]
 // @way [query]
 // @param
@@ -33,7 +122,7 @@ func GetNotices(c *gin.Context) {
 
 // @method [post]
 // @way [formdata]
-// @param sender, title, content, pub_at
+// @param sender, title, content, pub_at, campus, post_types, department_ids, uids, numbers, numbers_file, role, registered_from, registered_to
 // @return
 // @route /b/notice
 func AddNotice(c *gin.Context) {
@@ -54,12 +143,17 @@ func AddNotice(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.AddNoticeToAllUsers(uid, map[string]interface{}{
+	audience, err := parseNoticeAudience(c)
+	if err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
+	err = models.AddNoticeToAudience(uid, map[string]interface{}{
 		"sender":  sender,
 		"title":   title,
 		"content": content,
 		"pub_at":  pubAt,
-	})
+	}, audience)
 	if err != nil {
 		logging.Error("Add notice error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -70,7 +164,27 @@ func AddNotice(c *gin.Context) {
 
 // @method [post]
 // @way [formdata]
-// @param sender, title, content, pub_at
+// @param campus, post_types, department_ids, uids, numbers, numbers_file, role, registered_from, registered_to
+// @return count
+// @route /b/notice/audience/preview
+func PreviewNoticeAudience(c *gin.Context) {
+	audience, err := parseNoticeAudience(c)
+	if err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
+	cnt, err := models.CountNoticeAudience(audience)
+	if err != nil {
+		logging.Error("Preview notice audience error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"count": cnt})
+}
+
+// @method [post]
+// @way [formdata]
+// @param sender, title, content, symbol, locale
 // @return
 // @route /b/notice/template
 func AddNoticeTemplate(c *gin.Context) {
@@ -78,6 +192,7 @@ func AddNoticeTemplate(c *gin.Context) {
 	title := c.PostForm("title")
 	content := c.PostForm("content")
 	symbol := c.PostForm("symbol")
+	locale := c.PostForm("locale")
 	valid := validation.Validation{}
 	valid.Required(sender, "sender")
 	valid.MaxSize(sender, 30, "sender")
@@ -87,16 +202,22 @@ func AddNoticeTemplate(c *gin.Context) {
 	valid.MaxSize(content, 2000, "content")
 	valid.Required(symbol, "symbol")
 	valid.MaxSize(symbol, 50, "symbol")
+	valid.MaxSize(locale, 10, "locale")
 	ok, verr := r.ErrorValid(&valid, "Add notice template")
 	if !ok {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
+	if err := models.ValidNoticeTemplate(symbol, content); err != nil {
+		r.Error(c, e.ERROR_NOTICE_TEMPLATE, err.Error())
+		return
+	}
 	id, err := models.AddNoticeTemplate(map[string]interface{}{
 		"sender":  sender,
 		"title":   title,
 		"content": content,
 		"symbol":  symbol,
+		"locale":  locale,
 	})
 	if err != nil {
 		logging.Error("Add notice template error: %v", err)
@@ -108,6 +229,50 @@ func AddNoticeTemplate(c *gin.Context) {
 	r.OK(c, e.SUCCESS, data)
 }
 
+// @method [get]
+// @way [query]
+// @param
+// @return
+// @route /b/notice/templates
+func GetNoticeTemplates(c *gin.Context) {
+	list, err := models.GetNoticeTemplates()
+	if err != nil {
+		logging.Error("Get notice templates error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param symbol, content, args[key]
+// @return content, error
+// @route /b/notice/template/preview
+func PreviewNoticeTemplate(c *gin.Context) {
+	symbol := c.PostForm("symbol")
+	content := c.PostForm("content")
+	args := c.PostFormMap("args")
+	valid := validation.Validation{}
+	valid.Required(content, "content")
+	valid.MaxSize(content, 2000, "content")
+	ok, verr := r.ErrorValid(&valid, "Preview notice template")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	preview, err := models.PreviewNoticeTemplate(symbol, content, args)
+	data := map[string]interface{}{"content": preview}
+	if err != nil {
+		data["error"] = err
+	}
+	r.OK(c, e.SUCCESS, data)
+}
+
 // @method [put]
 // @way [formdata]
 // @param id, content
@@ -136,6 +301,11 @@ func EditNoticeTemplate(c *gin.Context) {
 		"title":   title,
 		"content": content,
 	})
+	var aerr *template.ArgsError
+	if errors.As(err, &aerr) {
+		r.Error(c, e.ERROR_NOTICE_TEMPLATE, err.Error())
+		return
+	}
 	if err != nil {
 		logging.Error("Edit notices error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
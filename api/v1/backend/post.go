@@ -2,6 +2,7 @@ package backend
 
 import (
 	"qnhd/api/v1/common"
+	"qnhd/enums/PermissionType"
 	"qnhd/enums/PostEtagType"
 	"qnhd/models"
 	"qnhd/pkg/e"
@@ -109,7 +110,7 @@ func TransferPostDepartment(c *gin.Context) {
 		return
 	}
 	// 判断是否是这个帖子的管理员
-	if !models.RequireRight(uid, models.UserRight{Super: true}) && !models.IsDepartmentHasUser(util.AsUint(uid), post.DepartmentId) {
+	if !models.HasPermissionIn(uid, PermissionType.DEPARTMENT_ALL, models.PostScope(post)) && !models.IsDepartmentHasUser(util.AsUint(uid), post.DepartmentId) {
 		r.Error(c, e.ERROR_RIGHT, "")
 		return
 	}
@@ -156,6 +157,10 @@ func DistributePost(c *gin.Context) {
 		r.Error(c, e.ERROR_POST_TYPE, "")
 		return
 	}
+	if !models.HasPermissionIn(uid, PermissionType.POST_DISTRIBUTE, models.PostScope(post)) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return
+	}
 	err = models.DistributePost(uid, postId, newDepartmentId)
 	if err != nil {
 		logging.Error("transfer department error: %v", err)
@@ -233,7 +238,11 @@ func EditPostValue(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.EditPostValue(uid, postId, util.AsInt(value))
+	scope, err := models.PostScopeById(util.AsUint(postId))
+	if !demandScope(c, PermissionType.POST_FEATURE, scope, err) {
+		return
+	}
+	err = models.EditPostValue(uid, postId, util.AsInt(value))
 	if err != nil {
 		logging.Error("edit post value error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -267,7 +276,11 @@ func EditPostEtag(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.EditPostEtag(uid, postId, PostEtagType.Enum(util.AsInt(value)))
+	scope, err := models.PostScopeById(util.AsUint(postId))
+	if !demandScope(c, PermissionType.POST_FEATURE, scope, err) {
+		return
+	}
+	err = models.EditPostEtag(uid, postId, PostEtagType.Enum(util.AsInt(value)))
 	if err != nil {
 		logging.Error("edit post etag error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -278,23 +291,29 @@ func EditPostEtag(c *gin.Context) {
 
 // @method [post]
 // @way [formdata]
-// @param post_id, tag_id
+// @param post_id, tag_ids
 // @return
 // @route /b/post_tag
 func AddPostTag(c *gin.Context) {
 	postId := c.PostForm("post_id")
-	tagId := c.PostForm("tag_id")
+	tagIds := c.PostFormArray("tag_ids")
+	// 兼容单个tag
+	if tagId := c.PostForm("tag_id"); tagId != "" {
+		tagIds = append(tagIds, tagId)
+	}
 	valid := validation.Validation{}
 	valid.Required(postId, "post_id")
 	valid.Numeric(postId, "post_id")
-	valid.Required(tagId, "post_id")
-	valid.Numeric(tagId, "post_id")
+	valid.MinSize(tagIds, 1, "tag_ids")
+	for _, tagId := range tagIds {
+		valid.Numeric(tagId, "tag_ids")
+	}
 	ok, verr := r.ErrorValid(&valid, "Add post tag")
 	if !ok {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.AddPostWithTag(nil, util.AsUint(postId), util.AsUint(tagId))
+	_, err := models.AddPostWithTags(nil, util.AsUint(postId), util.AsUints(tagIds))
 	if err != nil {
 		logging.Error("Add post tag error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -321,7 +340,18 @@ func DeletePost(c *gin.Context) {
 		return
 	}
 
-	_, err := models.DeletePostAdmin(uid, id)
+	post, err := models.GetPost(id)
+	if err != nil {
+		logging.Error("Delete post error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	// 角色限定了范围时只能删除范围内的帖子
+	if !models.HasPermissionIn(uid, PermissionType.POST_DELETE, models.PostScope(post)) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return
+	}
+	_, err = models.DeletePostAdmin(uid, id)
 	if err != nil {
 		logging.Error("Delete post error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -347,7 +377,11 @@ func RecoverPost(c *gin.Context) {
 		return
 	}
 
-	err := models.RecoverPost(postId)
+	scope, err := models.PostScopeById(util.AsUint(postId))
+	if !demandScope(c, PermissionType.POST_RECOVER, scope, err) {
+		return
+	}
+	err = models.RecoverPost(postId)
 	if err != nil {
 		logging.Error("Recover post error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -358,20 +392,30 @@ func RecoverPost(c *gin.Context) {
 
 // @method [get]
 // @way [query]
-// @param post_id
+// @param post_id, tag_ids
 // @return
 // @route /b/post_tag/delete
 func DeletePostTag(c *gin.Context) {
 	id := c.Query("post_id")
+	tagIds := c.QueryArray("tag_ids")
 	valid := validation.Validation{}
 	valid.Required(id, "post_id")
 	valid.Numeric(id, "post_id")
+	for _, tagId := range tagIds {
+		valid.Numeric(tagId, "tag_ids")
+	}
 	ok, verr := r.ErrorValid(&valid, "Delete post tag")
 	if !ok {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.DeleteTagInPost(nil, util.AsUint(id))
+	var err error
+	// 不指定tag时删除全部
+	if len(tagIds) == 0 {
+		err = models.DeleteTagInPost(nil, util.AsUint(id))
+	} else {
+		err = models.DeleteTagsInPost(nil, util.AsUint(id), util.AsUints(tagIds))
+	}
 	if err != nil {
 		logging.Error("Delete post tag error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -403,3 +447,17 @@ func DeletePostImages(c *gin.Context) {
 	}
 	r.OK(c, e.SUCCESS, nil)
 }
+
+// 角色限定了范围时只能操作范围内的帖子，失败时已经返回错误
+func demandScope(c *gin.Context, perm PermissionType.Enum, scope models.Scope, err error) bool {
+	if err != nil {
+		logging.Error("Get scope error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return false
+	}
+	if !models.HasPermissionIn(r.GetUid(c), perm, scope) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return false
+	}
+	return true
+}
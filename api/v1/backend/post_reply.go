@@ -2,6 +2,7 @@ package backend
 
 import (
 	"qnhd/api/v1/common"
+	"qnhd/enums/PermissionType"
 	"qnhd/enums/PostReplyType"
 	"qnhd/enums/PostSolveType"
 	"qnhd/models"
@@ -43,17 +44,16 @@ func AddPostReply(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	// 如果不是超管，看是否为部门对应管理
-	if !models.RequireRight(uid, models.UserRight{Super: true, SchDistributeAdmin: true}) {
-		depart, err := models.GetDepartmentByPostId(util.AsUint(postId))
-		if err != nil {
-			r.Error(c, e.ERROR_DATABASE, err.Error())
-			return
-		}
-		if !models.IsDepartmentHasUser(util.AsUint(uid), depart.Id) {
-			r.Error(c, e.ERROR_RIGHT, "")
-			return
-		}
+	// 如果不能处理帖子所在部门，看是否为部门对应管理
+	post, err := models.GetPost(postId)
+	if err != nil {
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	if !models.HasPermissionIn(uid, PermissionType.DEPARTMENT_ALL, models.PostScope(post)) &&
+		!models.IsDepartmentHasUser(util.AsUint(uid), post.DepartmentId) {
+		r.Error(c, e.ERROR_RIGHT, "")
+		return
 	}
 
 	// 限制无文字时必须有图
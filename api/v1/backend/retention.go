@@ -0,0 +1,40 @@
+package backend
+
+import (
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param
+// @return list 每张表将被清理的行数
+// @route /b/retention/preview
+func PreviewRetention(c *gin.Context) {
+	list, err := models.FlushRetention(true)
+	if err != nil {
+		logging.Error("Preview retention error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"list": list})
+}
+
+// @method [post]
+// @way [formdata]
+// @param
+// @return list 每张表清理的行数
+// @route /b/retention/run
+func RunRetention(c *gin.Context) {
+	list, err := models.FlushRetention(false)
+	if err != nil {
+		logging.Error("Run retention error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"list": list})
+}
@@ -0,0 +1,264 @@
+package backend
+
+import (
+	"errors"
+	"qnhd/enums/PermissionType"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param
+// @return roles, permissions
+// @route /b/roles
+func GetRoles(c *gin.Context) {
+	list, err := models.GetRoles()
+	if err != nil {
+		logging.Error("Get roles error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	var perms []string
+	for _, p := range PermissionType.All() {
+		perms = append(perms, p.GetSymbol())
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+	data["permissions"] = perms
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param name, description, permissions
+// @return id
+// @route /b/role
+func AddRole(c *gin.Context) {
+	uid := r.GetUid(c)
+	name := c.PostForm("name")
+	description := c.PostForm("description")
+	perms := c.PostFormArray("permissions")
+	valid := validation.Validation{}
+	valid.Required(name, "name")
+	valid.MaxSize(name, 30, "name")
+	valid.MaxSize(description, 200, "description")
+	ok, verr := r.ErrorValid(&valid, "Add role")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	id, err := models.AddRole(uid, map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"permissions": perms,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Add role error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"id": id})
+}
+
+// @method [post]
+// @way [formdata]
+// @param id, description, permissions
+// @return
+// @route /b/role/modify
+func EditRole(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.PostForm("id")
+	description := c.PostForm("description")
+	perms := c.PostFormArray("permissions")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	valid.MaxSize(description, 200, "description")
+	ok, verr := r.ErrorValid(&valid, "Edit role")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	err := models.EditRole(uid, util.AsUint(id), map[string]interface{}{
+		"description": description,
+		"permissions": perms,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Edit role error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param id, require 1为要求两步验证
+// @return
+// @route /b/role/totp
+func EditRoleTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.PostForm("id")
+	require := c.PostForm("require")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	valid.Required(require, "require")
+	valid.Numeric(require, "require")
+	valid.Range(util.AsInt(require), 0, 1, "require")
+	ok, verr := r.ErrorValid(&valid, "Edit role totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if err := models.EditRoleTotp(uid, util.AsUint(id), require == "1"); err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Edit role totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [get]
+// @way [query]
+// @param id
+// @return
+// @route /b/role/delete
+func DeleteRole(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.Query("id")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	ok, verr := r.ErrorValid(&valid, "Delete role")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if err := models.DeleteRole(uid, util.AsUint(id)); err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Delete role error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [get]
+// @way [query]
+// @param uid
+// @return roles
+// @route /b/user/roles
+func GetUserRoles(c *gin.Context) {
+	userId := c.Query("uid")
+	valid := validation.Validation{}
+	valid.Required(userId, "uid")
+	valid.Numeric(userId, "uid")
+	ok, verr := r.ErrorValid(&valid, "Get user roles")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	list, err := models.GetUserRoles(util.AsUint(userId))
+	if err != nil {
+		logging.Error("Get user roles error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param uid, role_id, department_id 可选，限定部门, post_type 可选，限定帖子类型
+// @return id
+// @route /b/user/role
+func AddUserRole(c *gin.Context) {
+	uid := r.GetUid(c)
+	userId := c.PostForm("uid")
+	roleId := c.PostForm("role_id")
+	departmentId := c.DefaultPostForm("department_id", "0")
+	postType := c.DefaultPostForm("post_type", "0")
+	valid := validation.Validation{}
+	valid.Required(userId, "uid")
+	valid.Numeric(userId, "uid")
+	valid.Required(roleId, "role_id")
+	valid.Numeric(roleId, "role_id")
+	valid.Numeric(departmentId, "department_id")
+	valid.Numeric(postType, "post_type")
+	ok, verr := r.ErrorValid(&valid, "Add user role")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	id, err := models.AddUserRole(uid, map[string]interface{}{
+		"uid":           util.AsUint(userId),
+		"role_id":       util.AsUint(roleId),
+		"department_id": util.AsUint(departmentId),
+		"post_type":     int(util.AsUint(postType)),
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Add user role error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"id": id})
+}
+
+// @method [get]
+// @way [query]
+// @param id
+// @return
+// @route /b/user/role/delete
+func DeleteUserRole(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.Query("id")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	ok, verr := r.ErrorValid(&valid, "Delete user role")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if err := models.DeleteUserRole(uid, util.AsUint(id)); err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
+		logging.Error("Delete user role error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"fmt"
 	ManagerLogType "qnhd/enums/MangerLogType"
 	"qnhd/models"
 	"qnhd/pkg/e"
@@ -8,6 +9,7 @@ import (
 	"qnhd/pkg/r"
 	"qnhd/pkg/util"
 	"qnhd/request/twtservice"
+	"strconv"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/gin-gonic/gin"
@@ -72,8 +74,15 @@ func GetTagDetail(c *gin.Context) {
 		return
 	}
 	models.AddManagerLogWithDetail(util.AsUint(doer), u.Uid, ManagerLogType.USER_DETAIL, "")
+	// 最近30天的每日热度
+	history, err := models.GetTagScoreHistory(tag.Id, 30)
+	if err != nil {
+		logging.Error("get tag detail error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
 
-	r.OK(c, e.SUCCESS, map[string]interface{}{"detail": detail})
+	r.OK(c, e.SUCCESS, map[string]interface{}{"detail": detail, "history": history})
 }
 
 // @method [get]
@@ -180,3 +189,117 @@ func ClearTagPoint(c *gin.Context) {
 	}
 	r.OK(c, e.SUCCESS, nil)
 }
+
+// @method [post]
+// @way [formdata]
+// @param id, source_ids
+// @return
+// @route /b/tag/merge
+func MergeTags(c *gin.Context) {
+	uid := r.GetUid(c)
+	id := c.PostForm("id")
+	sourceIds := c.PostFormArray("source_ids")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	valid.MinSize(sourceIds, 1, "source_ids")
+	for _, s := range sourceIds {
+		valid.Numeric(s, "source_ids")
+	}
+	ok, verr := r.ErrorValid(&valid, "Merge tags")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	err := models.MergeTags(uid, util.AsUint(id), util.AsUints(sourceIds))
+	if err != nil {
+		logging.Error("Merge tags error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [get]
+// @way [query]
+// @param id
+// @return aliases
+// @route /b/tag/aliases
+func GetTagAliases(c *gin.Context) {
+	id := c.Query("id")
+	valid := validation.Validation{}
+	valid.Required(id, "id")
+	valid.Numeric(id, "id")
+	ok, verr := r.ErrorValid(&valid, "Get tag aliases")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	list, err := models.GetTagAliases(util.AsUint(id))
+	if err != nil {
+		logging.Error("Get tag aliases error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"list": list, "total": len(list)})
+}
+
+// @method [get]
+// @way [query]
+// @param
+// @return setting
+// @route /b/tag/hot/setting
+func GetTagHotSetting(c *gin.Context) {
+	r.OK(c, e.SUCCESS, map[string]interface{}{"setting": models.GetTagHotConfig()})
+}
+
+// @method [post]
+// @way [formdata]
+// @param add_post, add_floor, like_post, fav_post, dis_post, like_floor, dis_floor, follower, half_life_hours, window_days
+// @return
+// @route /b/tag/hot/setting
+func EditTagHotSetting(c *gin.Context) {
+	uid := r.GetUid(c)
+	// 未传的参数保持不变
+	cfg := models.GetTagHotConfig()
+	fields := map[string]*float64{
+		"add_post":        &cfg.AddPost,
+		"add_floor":       &cfg.AddFloor,
+		"like_post":       &cfg.LikePost,
+		"fav_post":        &cfg.FavPost,
+		"dis_post":        &cfg.DisPost,
+		"like_floor":      &cfg.LikeFloor,
+		"dis_floor":       &cfg.DisFloor,
+		"follower":        &cfg.Follower,
+		"half_life_hours": &cfg.HalfLifeHours,
+	}
+	for k, v := range fields {
+		if f := c.PostForm(k); f != "" {
+			n, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				r.Error(c, e.INVALID_PARAMS, fmt.Sprintf("%s格式错误", k))
+				return
+			}
+			*v = n
+		}
+	}
+	windowDays := c.PostForm("window_days")
+	valid := validation.Validation{}
+	if windowDays != "" {
+		valid.Numeric(windowDays, "window_days")
+	}
+	ok, verr := r.ErrorValid(&valid, "Edit tag hot setting")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if windowDays != "" {
+		cfg.WindowDays = util.AsInt(windowDays)
+	}
+	if err := models.EditTagHotConfig(uid, cfg); err != nil {
+		logging.Error("Edit tag hot setting error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
@@ -2,9 +2,9 @@ package backend
 
 import (
 	"qnhd/enums/IdentityType"
+	"qnhd/enums/PermissionType"
 	"qnhd/middleware/jwt"
 	"qnhd/middleware/permission"
-	"qnhd/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,6 +26,8 @@ const (
 	PostType
 	Banner
 	Statistic
+	Retention
+	Role
 )
 
 var BackendTypes = [...]BackendType{
@@ -43,15 +45,33 @@ var BackendTypes = [...]BackendType{
 	PostType,
 	Banner,
 	Statistic,
+	Retention,
+	Role,
 }
 
 func Setup(g *gin.RouterGroup) {
 	// 获取token
 	g.GET("/auth", GetAuth)
-	g.GET("/auth/:token", RefreshToken)
 	g.GET("/auth/passwd", GetAuthPasswd)
+	g.POST("/auth/refresh", RefreshSession)
+	g.POST("/auth/totp/login", LoginTotp)
 	g.Use(jwt.JWT())
+	// 登录会话管理
+	g.GET("/auth/sessions", GetSessions)
+	g.POST("/auth/logout", Logout)
+	g.POST("/auth/logout/all", LogoutAll)
 	g.Use(permission.IdentityDemand(IdentityType.ADMIN))
+	// 修改自己密码，重置密码后只能访问这个接口
+	g.POST("/user/passwd/modify", EditUserPasswd)
+	g.Use(permission.ValidPasswordChanged())
+	// 两步验证，角色要求时只能先访问这些接口
+	g.GET("/auth/totp", GetTotpStatus)
+	g.POST("/auth/totp/setup", SetupTotp)
+	g.POST("/auth/totp/enable", EnableTotp)
+	g.POST("/auth/totp/disable", DisableTotp)
+	g.POST("/auth/totp/verify", VerifyTotp)
+	g.POST("/auth/totp/recovery_codes", RegenerateRecoveryCodes)
+	g.Use(permission.ValidTotpEnrolled())
 	for _, t := range BackendTypes {
 		initType(g, t)
 	}
@@ -60,15 +80,15 @@ func Setup(g *gin.RouterGroup) {
 func initType(g *gin.RouterGroup, t BackendType) {
 	switch t {
 	case Banned:
-		bannedGroup := g.Group("", permission.RightDemand(models.UserRight{Super: true}))
+		bannedGroup := g.Group("", permission.RightDemand(PermissionType.USER_BAN))
 		// 获取封禁用户列表
 		bannedGroup.GET("/banned", GetBanned)
 		// 新建封禁用户
-		bannedGroup.POST("/banned", AddBanned)
+		bannedGroup.POST("/banned", permission.RecentTotp(), AddBanned)
 		// 删除封禁用户
-		bannedGroup.GET("/banned/delete", DeleteBanned)
+		bannedGroup.GET("/banned/delete", permission.RecentTotp(), DeleteBanned)
 	case Blocked:
-		blockedGroup := g.Group("", permission.RightDemand(models.UserRight{Super: true, StuAdmin: true}))
+		blockedGroup := g.Group("", permission.RightDemand(PermissionType.USER_BLOCK))
 		// 获取禁言用户列表
 		blockedGroup.GET("/blocked", GetBlocked)
 		// 新建禁言用户
@@ -76,24 +96,30 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 删除指定禁言用户
 		blockedGroup.GET("/blocked/delete", DeleteBlocked)
 	case Notice:
-		noticeGroup := g.Group("", permission.RightDemand(models.UserRight{Super: true, SchAdmin: true}))
+		noticeGroup := g.Group("", permission.RightDemand(PermissionType.NOTICE_PUBLISH))
 		// 获取公告列表
 		noticeGroup.GET("/notices", GetNotices)
 		// 新建公告
-		noticeGroup.POST("/notice", AddNotice)
+		noticeGroup.POST("/notice", permission.RecentTotp(), AddNotice)
+		// 预览公告受众人数
+		noticeGroup.POST("/notice/audience/preview", PreviewNoticeAudience)
 		// 新建公告模板
 		noticeGroup.POST("/notice/template", AddNoticeTemplate)
+		// 获取系统通知模板
+		noticeGroup.GET("/notice/templates", GetNoticeTemplates)
+		// 预览通知模板
+		noticeGroup.POST("/notice/template/preview", PreviewNoticeTemplate)
 		// 修改公告
 		noticeGroup.POST("/notice/modify", EditNoticeTemplate)
 		// 删除指定公告
 		noticeGroup.GET("/notice/delete", DeleteNotice)
 	case User:
 		// 新建单个用户
-		g.POST("/user", permission.RightDemand(models.UserRight{Super: true}), AddUser)
+		g.POST("/user", permission.RightDemand(PermissionType.USER_MANAGE), AddUser)
 		// 新建多个用户
-		g.POST("/users", permission.RightDemand(models.UserRight{Super: true}), AddUsers)
+		g.POST("/users", permission.RightDemand(PermissionType.USER_MANAGE), AddUsers)
 		// 获取某用户详细信息
-		g.GET("/user/detail", permission.RightDemand(models.UserRight{Super: true}), GetUserDetail)
+		g.GET("/user/detail", permission.RightDemand(PermissionType.USER_DETAIL), permission.RecentTotp(), GetUserDetail)
 		// 获取请求者用户信息
 		g.GET("/user/info", GetUserInfo)
 		// 获取普通用户列表
@@ -101,24 +127,26 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 获取单个普通用户
 		g.GET("/user/common", GetCommonUser)
 		// 获取管理员列表
-		g.GET("/users/manager", permission.RightDemand(models.UserRight{Super: true}), GetManagers)
+		g.GET("/users/manager", permission.RightDemand(PermissionType.USER_MANAGE), GetManagers)
 		// 修改管理员密码
-		g.POST("/user/modify/super", permission.RightDemand(models.UserRight{Super: true}), EditUserPasswdBySuper)
-		// 修改自己密码
-		g.POST("/user/passwd/modify", EditUserPasswd)
+		g.POST("/user/modify/super", permission.RightDemand(PermissionType.USER_MANAGE), EditUserPasswdBySuper)
+		// 重置管理员密码为临时密码
+		g.POST("/user/passwd/reset", permission.RightDemand(PermissionType.USER_MANAGE), ResetUserPasswd)
+		// 重置丢失验证器的用户的两步验证
+		g.POST("/user/totp/reset", permission.RightDemand(PermissionType.USER_MANAGE), permission.RecentTotp(), ResetUserTotp)
 		// 修改自己手机
 		g.POST("/user/phone/modify", EditUserPhone)
 		// 修改用户权限
-		g.POST("/user/right/modify", permission.RightDemand(models.UserRight{Super: true}), EditUserRight)
+		g.POST("/user/right/modify", permission.RightDemand(PermissionType.ROLE_MANAGE), permission.RecentTotp(), EditUserRight)
 		// 修改用户部门
-		g.POST("/user/department/modify", permission.RightDemand(models.UserRight{Super: true}), EditUserDepartment)
+		g.POST("/user/department/modify", permission.RightDemand(PermissionType.USER_MANAGE), EditUserDepartment)
 		// 删除管理员
-		g.GET("/user/manager/delete", permission.RightDemand(models.UserRight{Super: true}), DeleteManager)
+		g.GET("/user/manager/delete", permission.RightDemand(PermissionType.USER_MANAGE), DeleteManager)
 	case Post:
 		// 获取帖子列表
 		g.GET("/posts", GetPosts())
 		// 获取未分发帖子
-		g.GET("/posts/undistributed", permission.RightDemand(models.UserRight{Super: true, SchDistributeAdmin: true}), GetUndistributedPosts)
+		g.GET("/posts/undistributed", permission.RightDemand(PermissionType.POST_DISTRIBUTE), GetUndistributedPosts)
 		// 获取用户帖子
 		g.GET("/posts/user", GetUserPosts)
 		// 获取帖子
@@ -126,27 +154,35 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 获取帖子回复
 		g.GET("/post/replys", GetPostReplys)
 		// 帖子回复校方回应
-		g.POST("/post/reply", permission.RightDemand(models.UserRight{Super: true, SchAdmin: true}), AddPostReply)
+		g.POST("/post/reply", permission.RightDemand(PermissionType.POST_REPLY), AddPostReply)
 		// 帖子转移部门
-		g.POST("/post/transfer/department", permission.RightDemand(models.UserRight{Super: true, SchAdmin: true}), TransferPostDepartment)
+		g.POST("/post/transfer/department", permission.RightDemand(PermissionType.POST_TRANSFER), TransferPostDepartment)
 		// 帖子换类型
 		g.POST("/post/transfer/type", TransferPostType)
 		// 分发帖子
-		g.POST("/post/distribute", permission.RightDemand(models.UserRight{Super: true, SchDistributeAdmin: true}), DistributePost)
+		g.POST("/post/distribute", permission.RightDemand(PermissionType.POST_DISTRIBUTE), DistributePost)
 		// 修改帖子加精值
-		g.POST("/post/value", permission.RightDemand(models.UserRight{Super: true, StuAdmin: true}), EditPostValue)
+		g.POST("/post/value", permission.RightDemand(PermissionType.POST_FEATURE), EditPostValue)
 		// 修改帖子额外标签
-		g.POST("/post/etag", permission.RightDemand(models.UserRight{Super: true, StuAdmin: true}), EditPostEtag)
+		g.POST("/post/etag", permission.RightDemand(PermissionType.POST_FEATURE), EditPostEtag)
 		// 删除指定帖子
-		g.GET("/post/delete", permission.RightDemand(models.UserRight{Super: true, SchDistributeAdmin: true, StuAdmin: true}), DeletePost)
+		g.GET("/post/delete", permission.RightDemand(PermissionType.POST_DELETE), DeletePost)
 		// 恢复指定帖子
-		g.POST("/post/recover", permission.RightDemand(models.UserRight{Super: true}), RecoverPost)
+		g.POST("/post/recover", permission.RightDemand(PermissionType.POST_RECOVER), RecoverPost)
 		// 添加帖子标签
 		g.POST("/post_tag", AddPostTag)
 		// 删除帖子的标签
 		g.GET("/post_tag/delete", DeletePostTag)
 		// 删除帖子的图片
 		g.GET("/post_image/delete", DeletePostImages)
+		// 下架图片，从所有帖子和楼层中移除
+		g.POST("/image/takedown", permission.RightDemand(PermissionType.POST_MODERATE), TakeDownImage)
+		// 因重复暂扣的内容
+		g.GET("/held_contents", permission.RightDemand(PermissionType.POST_MODERATE), GetHeldContents)
+		// 通过暂扣的内容
+		g.POST("/held_content/approve", permission.RightDemand(PermissionType.POST_MODERATE), ApproveHeldContent)
+		// 拒绝暂扣的内容
+		g.POST("/held_content/reject", permission.RightDemand(PermissionType.POST_MODERATE), RejectHeldContent)
 	case Report:
 		// 获取举报列表
 		g.GET("/reports", GetReports)
@@ -162,15 +198,15 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 查询多个楼层
 		g.GET("/floors", GetFloors)
 		// 删除指定楼层
-		g.GET("/floor/delete", permission.RightDemand(models.UserRight{Super: true, SchDistributeAdmin: true, StuAdmin: true}), DeleteFloor)
+		g.GET("/floor/delete", permission.RightDemand(PermissionType.FLOOR_DELETE), DeleteFloor)
 		// 恢复指定楼层
-		g.POST("/floor/recover", permission.RightDemand(models.UserRight{Super: true}), RecoverFloor)
+		g.POST("/floor/recover", permission.RightDemand(PermissionType.FLOOR_RECOVER), RecoverFloor)
 	case Tag:
 		// 查询标签
 		g.GET("/tags", GetTags)
 		// 获取热议标签
 		g.GET("/tags/hot", GetHotTag)
-		tg := g.Group("", permission.RightDemand(models.UserRight{Super: true}))
+		tg := g.Group("", permission.RightDemand(PermissionType.TAG_MANAGE))
 		// 删除指定标签
 		tg.GET("/tag/delete", DeleteTag)
 		// 获取标签详情
@@ -179,10 +215,18 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		tg.GET("/tag/clear", ClearTagPoint)
 		// 增加标签热度
 		tg.POST("/tag/point", AddTagPoint)
+		// 合并标签
+		tg.POST("/tag/merge", MergeTags)
+		// 获取标签别名
+		tg.GET("/tag/aliases", GetTagAliases)
+		// 获取标签热度参数
+		tg.GET("/tag/hot/setting", GetTagHotSetting)
+		// 修改标签热度参数
+		tg.POST("/tag/hot/setting", EditTagHotSetting)
 	case Department:
 		// 查询部门
 		g.GET("/departments", GetDepartments)
-		departGroup := g.Group("", permission.RightDemand(models.UserRight{Super: true}))
+		departGroup := g.Group("", permission.RightDemand(PermissionType.DEPARTMENT_MANAGE))
 		// 添加部门
 		departGroup.POST("/department", AddDepartment)
 		// 修改部门资料
@@ -193,9 +237,9 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 获取游戏列表
 		g.GET("/game", GetNewestGame)
 		// 更新游戏列表
-		g.POST("/game", permission.RightDemand(models.UserRight{Super: true}), AddNewGame)
+		g.POST("/game", permission.RightDemand(PermissionType.GAME_MANAGE), AddNewGame)
 	case Sensitive:
-		sGroup := g.Group("", permission.RightDemand(models.UserRight{Super: true}))
+		sGroup := g.Group("", permission.RightDemand(PermissionType.SENSITIVE_MANAGE))
 		// 获取关键词文件
 		sGroup.GET("/sensitive", GetSensitiveWordFile)
 		// 上传关键词文件
@@ -206,7 +250,7 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		// 获取帖子类型
 		g.GET("/posttypes", GetPostTypes)
 		// 增加帖子类型
-		g.POST("/posttype", permission.RightDemand(models.UserRight{Super: true}), AddPostType)
+		g.POST("/posttype", permission.RightDemand(PermissionType.POST_TYPE_MANAGE), AddPostType)
 	case Banner:
 		// 获取轮播图列表
 		g.GET("/banners", GetBanners)
@@ -223,5 +267,29 @@ func initType(g *gin.RouterGroup, t BackendType) {
 		g.GET("/statistic/floors/count", GetFloorCount)
 		// 获取帖子浏览数量
 		g.GET("/statistic/posts/visit/count", GetVisitPostCount)
+	case Retention:
+		retentionGroup := g.Group("", permission.RightDemand(PermissionType.RETENTION_MANAGE))
+		// 预览将被清理的数据
+		retentionGroup.GET("/retention/preview", PreviewRetention)
+		// 立即执行清理
+		retentionGroup.POST("/retention/run", RunRetention)
+	case Role:
+		roleGroup := g.Group("", permission.RightDemand(PermissionType.ROLE_MANAGE))
+		// 获取角色和所有权限
+		roleGroup.GET("/roles", GetRoles)
+		// 新建角色
+		roleGroup.POST("/role", AddRole)
+		// 修改角色权限
+		roleGroup.POST("/role/modify", permission.RecentTotp(), EditRole)
+		// 设置角色是否要求两步验证
+		roleGroup.POST("/role/totp", permission.RecentTotp(), EditRoleTotp)
+		// 删除角色
+		roleGroup.GET("/role/delete", DeleteRole)
+		// 获取用户的角色
+		roleGroup.GET("/user/roles", GetUserRoles)
+		// 给用户分配角色
+		roleGroup.POST("/user/role", permission.RecentTotp(), AddUserRole)
+		// 移除用户的角色
+		roleGroup.GET("/user/role/delete", DeleteUserRole)
 	}
 }
@@ -0,0 +1,192 @@
+package backend
+
+import (
+	"errors"
+	"qnhd/api/v1/common"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param
+// @return enabled, required, recovery_codes 剩余恢复码数量
+// @route /b/auth/totp
+func GetTotpStatus(c *gin.Context) {
+	uid := r.GetUid(c)
+	data, err := models.GetTotpStatus(util.AsUint(uid))
+	if err != nil {
+		logging.Error("Get totp status error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param
+// @return secret, uri 用于生成二维码的otpauth地址
+// @route /b/auth/totp/setup
+func SetupTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	secret, uri, err := models.SetupTotp(util.AsUint(uid))
+	if err != nil {
+		logging.Error("Setup totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{
+		"secret": secret,
+		"uri":    uri,
+	})
+}
+
+// @method [post]
+// @way [formdata]
+// @param code
+// @return recovery_codes 只显示这一次
+// @route /b/auth/totp/enable
+func EnableTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	code := c.PostForm("code")
+	valid := validation.Validation{}
+	valid.Required(code, "code")
+	ok, verr := r.ErrorValid(&valid, "Enable totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	codes, err := models.EnableTotp(util.AsUint(uid), code)
+	if err != nil {
+		if errors.Is(err, models.ErrTotpInvalid) {
+			r.Error(c, e.ERROR_TOTP_INVALID, err.Error())
+			return
+		}
+		logging.Error("Enable totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	// 开启时验证过一次，当前会话视为已验证
+	if err := models.MarkSessionTotp(r.GetSid(c)); err != nil {
+		logging.Error("Enable totp error: %v", err)
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"recovery_codes": codes})
+}
+
+// @method [post]
+// @way [formdata]
+// @param code 验证码或恢复码
+// @return
+// @route /b/auth/totp/disable
+func DisableTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	code := c.PostForm("code")
+	valid := validation.Validation{}
+	valid.Required(code, "code")
+	ok, verr := r.ErrorValid(&valid, "Disable totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if models.IsTotpRequired(util.AsUint(uid)) {
+		r.Error(c, e.ERROR_RIGHT, "当前角色要求开启两步验证")
+		return
+	}
+	if !common.VerifyTotp(c, util.AsUint(uid), code) {
+		return
+	}
+	if err := models.DisableTotp(util.AsUint(uid)); err != nil {
+		logging.Error("Disable totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param code 验证码或恢复码
+// @return
+// @route /b/auth/totp/verify
+func VerifyTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	code := c.PostForm("code")
+	valid := validation.Validation{}
+	valid.Required(code, "code")
+	ok, verr := r.ErrorValid(&valid, "Verify totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if !common.VerifyTotp(c, util.AsUint(uid), code) {
+		return
+	}
+	if err := models.MarkSessionTotp(r.GetSid(c)); err != nil {
+		logging.Error("Verify totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param code 验证码或恢复码
+// @return recovery_codes
+// @route /b/auth/totp/recovery_codes
+func RegenerateRecoveryCodes(c *gin.Context) {
+	uid := r.GetUid(c)
+	code := c.PostForm("code")
+	valid := validation.Validation{}
+	valid.Required(code, "code")
+	ok, verr := r.ErrorValid(&valid, "Regenerate recovery codes")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if !common.VerifyTotp(c, util.AsUint(uid), code) {
+		return
+	}
+	codes, err := models.RegenerateRecoveryCodes(util.AsUint(uid))
+	if err != nil {
+		logging.Error("Regenerate recovery codes error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"recovery_codes": codes})
+}
+
+// @method [post]
+// @way [formdata]
+// @param uid
+// @return
+// @route /b/user/totp/reset
+func ResetUserTotp(c *gin.Context) {
+	uid := r.GetUid(c)
+	userId := c.PostForm("uid")
+	valid := validation.Validation{}
+	valid.Required(userId, "uid")
+	valid.Numeric(userId, "uid")
+	ok, verr := r.ErrorValid(&valid, "Reset user totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if !models.CanManageUser(uid, util.AsUint(userId)) {
+		r.Error(c, e.ERROR_RIGHT, models.ErrPermissionExceeded.Error())
+		return
+	}
+	if err := models.ResetUserTotp(uid, util.AsUint(userId)); err != nil {
+		logging.Error("Reset user totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
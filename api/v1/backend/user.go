@@ -2,6 +2,7 @@ package backend
 
 import (
 	"encoding/json"
+	"errors"
 	ManagerLogType "qnhd/enums/MangerLogType"
 	"qnhd/models"
 	"qnhd/pkg/e"
@@ -75,8 +76,15 @@ func GetUserInfo(c *gin.Context) {
 		return
 	}
 	depart, _ := models.GetDepartmentByUid(util.AsUint(uid))
+	perms, err := models.GetUserPermissions(uid)
+	if err != nil {
+		logging.Error("get user info error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
 	data := map[string]interface{}{
-		"user_info": userInfo{User: user, Department: depart},
+		"user_info":   userInfo{User: user, Department: depart},
+		"permissions": perms,
 	}
 	r.OK(c, e.SUCCESS, data)
 
@@ -205,6 +213,10 @@ func AddUser(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
+	if err := util.CheckPasswordPolicy(password); err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
 	uid, err := models.ExistUser(nickname, "")
 	if err != nil {
 		logging.Error("Add user error: %v", err)
@@ -233,6 +245,7 @@ func AddUser(c *gin.Context) {
 // @return
 // @route /b/user
 func AddUsers(c *gin.Context) {
+	uid := r.GetUid(c)
 	var users []models.NewUserData
 	content := c.PostForm("content")
 
@@ -240,7 +253,11 @@ func AddUsers(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, err.Error())
 		return
 	}
-	if err := models.AddUsers(users); err != nil {
+	if err := models.AddUsers(uid, users); err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
 		r.Error(c, e.ERROR_DATABASE, err.Error())
 		return
 	}
@@ -253,6 +270,7 @@ func AddUsers(c *gin.Context) {
 // @return
 // @route /b/user/modify/super
 func EditUserPasswdBySuper(c *gin.Context) {
+	uid := r.GetUid(c)
 	changeid := c.PostForm("uid")
 	// 超管需要修改密码
 	newPass := c.PostForm("new_password")
@@ -265,20 +283,58 @@ func EditUserPasswdBySuper(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	data := make(map[string]interface{})
+	if !models.CanManageUser(uid, util.AsUint(changeid)) {
+		r.Error(c, e.ERROR_RIGHT, models.ErrPermissionExceeded.Error())
+		return
+	}
+	// 超管修改的密码视为重置，用户登录后需要修改
 	if newPass != "" {
-		data["password"] = newPass
+		if _, err := models.ResetUserPasswd(changeid, newPass); err != nil {
+			logging.Error("Reset password error: %v", err)
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+			return
+		}
 	}
 	if newPhone != "" {
-		data["phone_number"] = newPhone
+		err := models.EditUser(changeid, map[string]interface{}{"phone_number": newPhone})
+		if err != nil {
+			logging.Error("Edit users error: %v", err)
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+			return
+		}
 	}
-	err := models.EditUser(changeid, data)
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param uid
+// @return password 临时密码
+// @route /b/user/passwd/reset
+func ResetUserPasswd(c *gin.Context) {
+	uid := r.GetUid(c)
+	changeid := c.PostForm("uid")
+	valid := validation.Validation{}
+	valid.Required(changeid, "uid")
+	valid.Numeric(changeid, "uid")
+	ok, verr := r.ErrorValid(&valid, "Reset password")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if !models.CanManageUser(uid, util.AsUint(changeid)) {
+		r.Error(c, e.ERROR_RIGHT, models.ErrPermissionExceeded.Error())
+		return
+	}
+	password, err := models.ResetUserPasswd(changeid, "")
 	if err != nil {
-		logging.Error("Edit users error: %v", err)
+		logging.Error("Reset password error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
 		return
 	}
-	r.OK(c, e.SUCCESS, nil)
+	data := make(map[string]interface{})
+	data["password"] = password
+	r.OK(c, e.SUCCESS, data)
 }
 
 // @method [put]
@@ -299,9 +355,7 @@ func EditUserPasswd(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	data := make(map[string]interface{})
-	data["password"] = newPass
-	err := models.EditUserPasswd(uid, rawPass, newPass)
+	err := models.EditUserPasswd(uid, rawPass, newPass, r.GetSid(c))
 	if err != nil {
 		logging.Error("Edit users error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -336,10 +390,13 @@ func EditUserPhone(c *gin.Context) {
 // @return
 // @route /b/user/right
 func EditUserRight(c *gin.Context) {
-	uid := c.PostForm("uid")
+	uid := r.GetUid(c)
+	userId := c.PostForm("uid")
 	schAdmin := c.PostForm("sch_admin")
 	stuAdmin := c.PostForm("stu_admin")
 	valid := validation.Validation{}
+	valid.Required(userId, "uid")
+	valid.Numeric(userId, "uid")
 	valid.Required(schAdmin, "schAdmin")
 	valid.Required(stuAdmin, "stuAdmin")
 	valid.Numeric(schAdmin, "schAdmin")
@@ -350,21 +407,22 @@ func EditUserRight(c *gin.Context) {
 		return
 	}
 
-	stui := util.AsUint(schAdmin)
-	schi := util.AsUint(stuAdmin)
-	valid.Range(int(stui), 0, 1, "stuAdmin")
+	schi := util.AsUint(schAdmin)
+	stui := util.AsUint(stuAdmin)
 	valid.Range(int(schi), 0, 1, "schAdmin")
+	valid.Range(int(stui), 0, 1, "stuAdmin")
 	ok, verr = r.ErrorValid(&valid, "Edit user right")
 	if !ok {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
 
-	maps := map[string]interface{}{
-		"is_sch_admin": schAdmin,
-		"is_stu_admin": stuAdmin,
-	}
-	if err := models.EditUser(uid, maps); err != nil {
+	// 对应内置的部门管理员和学生管理员角色
+	if err := models.EditUserRight(uid, util.AsUint(userId), schi == 1, stui == 1); err != nil {
+		if errors.Is(err, models.ErrPermissionExceeded) {
+			r.Error(c, e.ERROR_RIGHT, err.Error())
+			return
+		}
 		r.Error(c, e.ERROR_DATABASE, err.Error())
 		logging.Error("Edit user error: %v", err)
 		return
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"qnhd/models"
@@ -88,13 +89,15 @@ func auth(result twtservice.TwTAuthResult, c *gin.Context) {
 
 	user, _ := models.GetUser(map[string]interface{}{"id": uid})
 
-	token, err := util.GenerateToken(fmt.Sprintf("%d", uid))
-	if err != nil {
+	if err := IssueToken(c, uid, data); err != nil {
+		if errors.Is(err, models.ErrTotpRequired) {
+			r.OK(c, e.ERROR_TOTP_REQUIRED, data)
+			return
+		}
 		logging.Error("auth error: %v", err)
 		r.OK(c, e.ERROR_AUTH, map[string]interface{}{"error": err.Error()})
 		return
 	}
-	data["token"] = token
 	data["uid"] = uid
 	data["user"] = user
 	r.OK(c, e.SUCCESS, data)
@@ -109,32 +112,176 @@ func genNickname() string {
 	}
 	return ret
 }
+
+// 新建登录会话，返回access token和refresh token
+// 开启了两步验证时只返回totp_token，验证后再登录
+func IssueToken(c *gin.Context, uid uint64, data map[string]interface{}) error {
+	if models.IsTotpEnabled(uid) {
+		token, err := util.GenerateTotpToken(fmt.Sprintf("%d", uid))
+		if err != nil {
+			return err
+		}
+		data["totp_token"] = token
+		return models.ErrTotpRequired
+	}
+	_, err := issueToken(c, uid, data)
+	return err
+}
+
+func issueToken(c *gin.Context, uid uint64, data map[string]interface{}) (string, error) {
+	session, refresh, err := models.CreateSession(uid, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return "", err
+	}
+	token, err := util.GenerateToken(fmt.Sprintf("%d", uid), session.Id)
+	if err != nil {
+		return "", err
+	}
+	data["token"] = token
+	data["refresh_token"] = refresh
+	return session.Id, nil
+}
+
+// 使用totp_token和验证码或恢复码完成登录
+func LoginTotp(c *gin.Context) {
+	totpToken := c.PostForm("totp_token")
+	code := c.PostForm("code")
+	valid := validation.Validation{}
+	valid.Required(totpToken, "totp_token")
+	valid.Required(code, "code")
+	ok, verr := r.ErrorValid(&valid, "Login totp")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	uid, err := util.ParseTotpToken(totpToken)
+	if err != nil {
+		r.Error(c, e.ERROR_AUTH_CHECK_TOKEN_FAIL, err.Error())
+		return
+	}
+	if !VerifyTotp(c, util.AsUint(uid), code) {
+		return
+	}
+	data := make(map[string]interface{})
+	sid, err := issueToken(c, util.AsUint(uid), data)
+	if err != nil {
+		logging.Error("Login totp error: %v", err)
+		r.OK(c, e.ERROR_GENERATE_TOKEN, nil)
+		return
+	}
+	if err := models.MarkSessionTotp(sid); err != nil {
+		logging.Error("Login totp error: %v", err)
+	}
+	user, _ := models.GetUser(map[string]interface{}{"id": uid})
+	data["uid"] = user.Uid
+	data["user"] = user
+	data["must_change_password"] = user.MustChangePassword
+	r.OK(c, e.SUCCESS, data)
+}
+
+// 校验两步验证码，失败时写入响应
+func VerifyTotp(c *gin.Context, uid uint64, code string) bool {
+	err := models.VerifyTotp(uid, code)
+	if err == nil {
+		return true
+	}
+	switch {
+	case errors.Is(err, models.ErrTotpInvalid):
+		r.Error(c, e.ERROR_TOTP_INVALID, err.Error())
+	case errors.Is(err, models.ErrPasswordLocked):
+		r.Error(c, e.ERROR_AUTH_LOCKED, err.Error())
+	default:
+		logging.Error("Verify totp error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+	}
+	return false
+}
+
+// 使用refresh token换取新的token，refresh token只能使用一次
 func RefreshToken(c *gin.Context) {
-	token := c.Param("token")
+	// 只从请求体中读取，避免token出现在访问日志中
+	refresh := c.PostForm("refresh_token")
 	valid := validation.Validation{}
-	valid.Required(token, "token")
+	valid.Required(refresh, "refresh_token")
 	ok, verr := r.ErrorValid(&valid, "Refresh Token")
 	if !ok {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
 
-	claims, err := util.ParseToken(token)
+	session, refresh, err := models.RefreshSession(refresh)
 	if err != nil {
 		logging.Error(err.Error())
-		r.OK(c, e.ERROR_AUTH_CHECK_TOKEN_FAIL, map[string]interface{}{"error": err.Error()})
+		if errors.Is(err, models.ErrSessionRevoked) {
+			r.Error(c, e.ERROR_AUTH_SESSION_REVOKED, err.Error())
+		} else {
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+		}
 		return
 	}
 
 	var code = e.SUCCESS
 	var data = make(map[string]interface{})
-	// tag = 1 means is USER
-	token, err = util.GenerateToken(claims.Uid)
+	token, err := util.GenerateToken(fmt.Sprintf("%d", session.Uid), session.Id)
 	if err != nil {
 		code = e.ERROR_GENERATE_TOKEN
 	} else {
 		data["token"] = token
-		data["uid"] = util.AsUint(claims.Uid)
+		data["refresh_token"] = refresh
+		data["uid"] = session.Uid
 	}
 	r.OK(c, code, data)
 }
+
+// 获取自己的登录会话
+func GetSessions(c *gin.Context) {
+	uid := r.GetUid(c)
+	list, err := models.GetUserSessions(util.AsUint(uid), r.GetSid(c))
+	if err != nil {
+		logging.Error("Get sessions error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+	r.OK(c, e.SUCCESS, data)
+}
+
+// 注销指定会话，不传时注销当前会话
+func Logout(c *gin.Context) {
+	uid := r.GetUid(c)
+	sid := c.PostForm("id")
+	if sid == "" {
+		sid = r.GetSid(c)
+	}
+	if err := models.RevokeSession(util.AsUint(uid), sid); err != nil {
+		logging.Error("Logout error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// 注销全部会话，keep_current为1时保留当前会话
+func LogoutAll(c *gin.Context) {
+	uid := r.GetUid(c)
+	keepCurrent := c.PostForm("keep_current")
+	valid := validation.Validation{}
+	valid.Numeric(keepCurrent, "keep_current")
+	ok, verr := r.ErrorValid(&valid, "Logout all")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	except := ""
+	if keepCurrent == "1" {
+		except = r.GetSid(c)
+	}
+	if err := models.RevokeUserSessions(util.AsUint(uid), except); err != nil {
+		logging.Error("Logout all error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
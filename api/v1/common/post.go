@@ -28,6 +28,10 @@ func GetPosts(front bool) gin.HandlerFunc {
 		valid.Required(postType, "type")
 		valid.Numeric(postType, "type")
 		valid.Required(searchMode, "search_mode")
+		// 也可以使用名称，如 trending
+		if mode, ok := PostSearchModeType.FromSymbol(searchMode); ok {
+			searchMode = util.AsStrU(uint64(mode))
+		}
 		valid.Numeric(searchMode, "search_mode")
 		if valueMode == "" {
 			// 默认值
@@ -44,7 +48,7 @@ func GetPosts(front bool) gin.HandlerFunc {
 		valid.Numeric(tagId, "tag_id")
 		postTypeint := util.AsInt(postType)
 		searchModeint := util.AsInt(searchMode)
-		valid.Range(searchModeint, 0, 1, "search_mode")
+		valid.Range(searchModeint, 0, 2, "search_mode")
 		if solved != "" {
 			solvedint := util.AsInt(solved)
 			valid.Range(solvedint, 0, 3, "solved")
@@ -24,11 +24,47 @@ func GetAuthPasswd(c *gin.Context) {
 	common.GetAuthPasswd(c)
 }
 
+// @method [post]
+// @way [formdata]
+// @param refresh_token
+// @return token, refresh_token
+// @route /f/auth/refresh
+func RefreshSession(c *gin.Context) {
+	common.RefreshToken(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param totp_token, code 验证码或恢复码
+// @return token, refresh_token
+// @route /f/auth/totp/login
+func LoginTotp(c *gin.Context) {
+	common.LoginTotp(c)
+}
+
 // @method [get]
 // @way [query]
-// @param token
-// @return token
-// @route /f/auth/:token
-func RefreshToken(c *gin.Context) {
-	common.RefreshToken(c)
+// @param
+// @return list
+// @route /f/auth/sessions
+func GetSessions(c *gin.Context) {
+	common.GetSessions(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param id 不传时注销当前会话
+// @return
+// @route /f/auth/logout
+func Logout(c *gin.Context) {
+	common.Logout(c)
+}
+
+// @method [post]
+// @way [formdata]
+// @param keep_current
+// @return
+// @route /f/auth/logout/all
+func LogoutAll(c *gin.Context) {
+	common.LogoutAll(c)
 }
@@ -0,0 +1,39 @@
+package frontend
+
+import (
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按配置处理重复内容，返回是否已经响应
+// 提示时正常发布，由调用方在返回数据中带上重复的内容
+func handleDuplicate(c *gin.Context, dup *models.DuplicateResult, hold func(*models.DuplicateResult) (uint64, error)) bool {
+	if dup == nil {
+		return false
+	}
+	switch setting.DuplicateSetting.Action {
+	case models.DUPLICATE_REJECT:
+		r.OK(c, e.ERROR_DUPLICATE_CONTENT, map[string]interface{}{
+			"duplicate": dup,
+		})
+		return true
+	case models.DUPLICATE_HOLD:
+		id, err := hold(dup)
+		if err != nil {
+			logging.Error("Hold content error: %v", err)
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+			return true
+		}
+		r.OK(c, e.ERROR_CONTENT_HELD, map[string]interface{}{
+			"held_id":   id,
+			"duplicate": dup,
+		})
+		return true
+	}
+	return false
+}
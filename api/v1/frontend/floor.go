@@ -146,6 +146,11 @@ func AddFloor(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, "缺失图片或内容")
 		return
 	}
+	// 只接受上传过的图片
+	if err := models.ValidImageUrls(imageURLs); err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
 
 	intpostid := util.AsUint(postId)
 	intuid := util.AsUint(uid)
@@ -160,6 +165,17 @@ func AddFloor(c *gin.Context) {
 		"image_url": imageURL,
 	}
 
+	// 检查与帖子内的楼层是否重复
+	dup, err := models.CheckDuplicateFloor(intuid, intpostid, content)
+	if err != nil {
+		logging.Error("Check duplicate floor error: %v", err)
+	}
+	if handleDuplicate(c, dup, func(d *models.DuplicateResult) (uint64, error) {
+		return models.HoldFloor(maps, d)
+	}) {
+		return
+	}
+
 	id, err := models.AddFloor(maps)
 	if err != nil {
 		logging.Error("Add floor error: %v", err)
@@ -168,6 +184,9 @@ func AddFloor(c *gin.Context) {
 	}
 	data := make(map[string]interface{})
 	data["id"] = id
+	if dup != nil {
+		data["duplicate"] = dup
+	}
 	r.OK(c, e.SUCCESS, data)
 }
 
@@ -197,6 +216,11 @@ func ReplyFloor(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, "缺失图片或内容")
 		return
 	}
+	// 只接受上传过的图片
+	if err := models.ValidImageUrls(imageURLs); err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
 	intuid := util.AsUint(uid)
 	intfloor := util.AsUint(replyToFloor)
 	imageURL := ""
@@ -210,6 +234,17 @@ func ReplyFloor(c *gin.Context) {
 		"image_url":    imageURL,
 	}
 
+	// 检查与帖子内的楼层是否重复
+	dup, err := models.CheckDuplicateReply(intuid, intfloor, content)
+	if err != nil {
+		logging.Error("Check duplicate floor error: %v", err)
+	}
+	if handleDuplicate(c, dup, func(d *models.DuplicateResult) (uint64, error) {
+		return models.HoldFloor(maps, d)
+	}) {
+		return
+	}
+
 	id, err := models.ReplyFloor(maps)
 	if err != nil {
 		logging.Error("Reply floor error: %v", err)
@@ -218,6 +253,9 @@ func ReplyFloor(c *gin.Context) {
 	}
 	data := make(map[string]interface{})
 	data["id"] = id
+	if dup != nil {
+		data["duplicate"] = dup
+	}
 	r.OK(c, e.SUCCESS, data)
 }
 
@@ -0,0 +1,75 @@
+package frontend
+
+import (
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param post_id
+// @return
+// @route /f/history/delete
+func DeleteHistory(c *gin.Context) {
+	uid := r.GetUid(c)
+	postId := c.Query("post_id")
+	valid := validation.Validation{}
+	valid.Required(postId, "post_id")
+	valid.Numeric(postId, "post_id")
+	ok, verr := r.ErrorValid(&valid, "Delete history")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if err := models.DeleteVisitHistory(util.AsUint(uid), util.AsUint(postId)); err != nil {
+		logging.Error("Delete history error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [get]
+// @way [query]
+// @param
+// @return
+// @route /f/history/clear
+func ClearHistory(c *gin.Context) {
+	uid := r.GetUid(c)
+	if err := models.ClearVisitHistory(util.AsUint(uid)); err != nil {
+		logging.Error("Clear history error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param disabled 0/1, 关闭时清空已有记录
+// @return
+// @route /f/history/setting
+func EditHistorySetting(c *gin.Context) {
+	uid := r.GetUid(c)
+	disabled := c.PostForm("disabled")
+	valid := validation.Validation{}
+	valid.Required(disabled, "disabled")
+	valid.Range(util.AsInt(disabled), 0, 1, "disabled")
+	ok, verr := r.ErrorValid(&valid, "Edit history setting")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if err := models.EditUserHistoryDisabled(util.AsUint(uid), disabled == "1"); err != nil {
+		logging.Error("Edit history setting error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
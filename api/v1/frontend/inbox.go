@@ -0,0 +1,109 @@
+package frontend
+
+import (
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param cursor, page_size
+// @return list, next_cursor, count
+// @route /f/inbox
+func GetInbox(c *gin.Context) {
+	uid := util.AsUint(r.GetUid(c))
+	cursor := c.Query("cursor")
+	pageSize := c.DefaultQuery("page_size", "10")
+	valid := validation.Validation{}
+	valid.Numeric(pageSize, "page_size")
+	valid.Range(util.AsInt(pageSize), 1, 100, "page_size")
+	ok, verr := r.ErrorValid(&valid, "Get inbox")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	if cursor != "" {
+		if _, err := models.ParseInboxCursor(cursor); err != nil {
+			r.Error(c, e.INVALID_PARAMS, err.Error())
+			return
+		}
+	}
+
+	list, next, err := models.GetInbox(c, uid, cursor, util.AsInt(pageSize))
+	if err != nil {
+		logging.Error("Get inbox error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	cnt, err := models.GetMessageCount(util.AsStrU(uid))
+	if err != nil {
+		logging.Error("Get message count error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{
+		"list":        list,
+		"total":       len(list),
+		"next_cursor": next,
+		"count":       cnt,
+	})
+}
+
+// 校验消息id
+func validInboxItemIds(c *gin.Context, itemIds []string) bool {
+	if len(itemIds) == 0 {
+		r.Error(c, e.INVALID_PARAMS, "item_ids不能为空")
+		return false
+	}
+	for _, id := range itemIds {
+		if _, err := models.ParseInboxItemId(id); err != nil {
+			r.Error(c, e.INVALID_PARAMS, err.Error())
+			return false
+		}
+	}
+	return true
+}
+
+// @method [post]
+// @way [formdata]
+// @param item_ids array
+// @return
+// @route /f/inbox/read
+func ReadInboxItems(c *gin.Context) {
+	uid := util.AsUint(r.GetUid(c))
+	itemIds := c.PostFormArray("item_ids")
+	if !validInboxItemIds(c, itemIds) {
+		return
+	}
+	if err := models.ReadInboxItems(uid, itemIds); err != nil {
+		logging.Error("Read inbox items error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param item_ids array
+// @return
+// @route /f/inbox/delete
+func DeleteInboxItems(c *gin.Context) {
+	uid := util.AsUint(r.GetUid(c))
+	itemIds := c.PostFormArray("item_ids")
+	if !validInboxItemIds(c, itemIds) {
+		return
+	}
+	if err := models.DeleteInboxItems(uid, itemIds); err != nil {
+		logging.Error("Delete inbox items error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
@@ -1,12 +1,17 @@
 package frontend
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"qnhd/enums/LikeType"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/r"
+	"qnhd/pkg/stream"
 	"qnhd/pkg/util"
+	"time"
 
 	"github.com/astaxie/beego/validation"
 	"github.com/gin-gonic/gin"
@@ -118,12 +123,13 @@ func GetMessagePostReplys(c *gin.Context) {
 
 // @method [post]
 // @way [formdata]
-// @param id
+// @param id, broadcast
 // @return
 // @route /f/message/notice/read
 func ReadNotice(c *gin.Context) {
 	uid := r.GetUid(c)
 	id := c.PostForm("id")
+	broadcast := c.PostForm("broadcast")
 	valid := validation.Validation{}
 	valid.Required(id, "id")
 	valid.Numeric(id, "id")
@@ -132,7 +138,7 @@ func ReadNotice(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, verr.Error())
 		return
 	}
-	err := models.ReadNotice(util.AsUint(uid), util.AsUint(id))
+	err := models.ReadNotice(util.AsUint(uid), util.AsUint(id), broadcast == "1")
 	if err != nil {
 		logging.Error("Read notice error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -143,13 +149,30 @@ func ReadNotice(c *gin.Context) {
 
 // @method [delete]
 // @way [query]
-// @param ids
+// @param ids, broadcast_ids
 // @return
 // @route /f/message/notices/delete
 func DeleteMessageNotices(c *gin.Context) {
 	uid := r.GetUid(c)
 	ids := c.QueryArray("ids")
-	err := models.DeleteMessageNotices(uid, ids)
+	broadcastIds := c.QueryArray("broadcast_ids")
+	valid := validation.Validation{}
+	for _, id := range ids {
+		valid.Numeric(id, "ids")
+	}
+	for _, id := range broadcastIds {
+		valid.Numeric(id, "broadcast_ids")
+	}
+	ok, verr := r.ErrorValid(&valid, "Delete notices")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	var bids []uint64
+	for _, id := range broadcastIds {
+		bids = append(bids, util.AsUint(id))
+	}
+	err := models.DeleteMessageNotices(uid, ids, bids)
 	if err != nil {
 		logging.Error("Delete notices error: %v", err)
 		r.Error(c, e.ERROR_DATABASE, err.Error())
@@ -301,3 +324,78 @@ func ReadAllMessage(c *gin.Context) {
 	}
 	r.OK(c, e.SUCCESS, nil)
 }
+
+// @method [get]
+// @way [query]
+// @param last_event_id 也可以通过Last-Event-ID请求头传入
+// @return text/event-stream
+// @route /f/message/stream
+func GetMessageStream(c *gin.Context) {
+	uid := util.AsUint(r.GetUid(c))
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("last_event_id")
+	}
+	valid := validation.Validation{}
+	if lastEventId != "" {
+		valid.Numeric(lastEventId, "last_event_id")
+	}
+	ok, verr := r.ErrorValid(&valid, "Get message stream")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	lastId := util.AsUint(lastEventId)
+
+	// 先订阅，避免补发期间漏掉事件
+	events, unsubscribe := stream.Subscribe(uid)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	send := func(w io.Writer, ev models.MessageEvent) {
+		data, _ := json.Marshal(ev)
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Id, ev.Type, data)
+		lastId = ev.Id
+	}
+	c.Stream(func(w io.Writer) bool {
+		// 连接会被WriteTimeout断开，让客户端尽快重连
+		fmt.Fprintf(w, "retry: 1000\n\n")
+		// 补发断线期间的事件
+		if lastId > 0 {
+			missed, err := models.GetMessageEventsAfter(uid, lastId)
+			if err != nil {
+				logging.Error("Get missed message events error: %v", err)
+			}
+			for _, ev := range missed {
+				send(w, ev)
+			}
+		}
+		// 当前的未读数
+		if cnt, err := models.GetMessageCount(util.AsStrU(uid)); err == nil {
+			data, _ := json.Marshal(cnt)
+			fmt.Fprintf(w, "event: count\ndata: %s\n\n", data)
+		}
+		return false
+	})
+
+	heartbeat := time.NewTicker(stream.HEARTBEAT)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev := <-events:
+			// 补发过的不再发送
+			if ev.Id > lastId {
+				send(w, ev)
+			}
+		case <-heartbeat.C:
+			fmt.Fprintf(w, ": ping\n\n")
+		}
+		return true
+	})
+}
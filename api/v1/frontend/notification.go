@@ -0,0 +1,63 @@
+package frontend
+
+import (
+	"qnhd/enums/NotificationEventType"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/util"
+
+	"github.com/astaxie/beego/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// @method [get]
+// @way [query]
+// @param
+// @return list
+// @route /f/notification/preferences
+func GetNotificationPreferences(c *gin.Context) {
+	uid := r.GetUid(c)
+	list, err := models.GetNotificationPreferences(util.AsUint(uid))
+	if err != nil {
+		logging.Error("get notification preferences error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"list": list})
+}
+
+// @method [post]
+// @way [formdata]
+// @param event, in_app(0/1), push(0/1)
+// @return
+// @route /f/notification/preference
+func EditNotificationPreference(c *gin.Context) {
+	uid := r.GetUid(c)
+	event := c.PostForm("event")
+	inApp := c.DefaultPostForm("in_app", "1")
+	push := c.DefaultPostForm("push", "1")
+	valid := validation.Validation{}
+	valid.Required(event, "event")
+	valid.Numeric(event, "event")
+	valid.Range(util.AsInt(inApp), 0, 1, "in_app")
+	valid.Range(util.AsInt(push), 0, 1, "push")
+	ok, verr := r.ErrorValid(&valid, "Edit notification preference")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	eventType := NotificationEventType.Enum(util.AsInt(event))
+	if !eventType.IsValid() {
+		r.Error(c, e.INVALID_PARAMS, "event不存在")
+		return
+	}
+
+	if err := models.EditNotificationPreference(util.AsUint(uid), eventType, inApp == "1", push == "1"); err != nil {
+		logging.Error("edit notification preference error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
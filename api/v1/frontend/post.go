@@ -9,6 +9,7 @@ import (
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/r"
+	"qnhd/pkg/setting"
 	"qnhd/request/yunpian"
 
 	"qnhd/pkg/util"
@@ -75,6 +76,29 @@ func GetFavPosts(c *gin.Context) {
 	r.OK(c, e.SUCCESS, data)
 }
 
+// @method [get]
+// @way [query]
+// @param page page_size
+// @return postList
+// @route /f/posts/following
+func GetFollowingPosts(c *gin.Context) {
+	uid := r.GetUid(c)
+	list, err := models.GetFollowingPostResponses(c, uid)
+	if err != nil {
+		logging.Error("Get following posts error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	for i := range list {
+		list[i].Uid = crypto.Encrypt(list[i].Uid, list[i].Id)
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+
+	r.OK(c, e.SUCCESS, data)
+}
+
 // @method [get]
 // @way [query]
 // @param page page_size
@@ -110,7 +134,7 @@ func GetPost() gin.HandlerFunc {
 
 // @method [post]
 // @way [formdata]
-// @param uid, type, title, content, campus, department_id, images
+// @param uid, type, title, content, campus, department_id, images, tag_ids
 // @return uploadres
 // @route /f/post
 func AddPost(c *gin.Context) {
@@ -118,7 +142,11 @@ func AddPost(c *gin.Context) {
 	postType := c.PostForm("type")
 	title := c.PostForm("title")
 	content := c.PostForm("content")
-	tagId := c.PostForm("tag_id")
+	tagIds := c.PostFormArray("tag_ids")
+	// 兼容单个tag
+	if tagId := c.PostForm("tag_id"); tagId != "" {
+		tagIds = append(tagIds, tagId)
+	}
 	campus := c.PostForm("campus")
 	departId := c.PostForm("department_id")
 	imageURLs := c.PostFormArray("images")
@@ -152,8 +180,9 @@ func AddPost(c *gin.Context) {
 		valid.Numeric(departId, "department_id")
 	} else if models.IsValidPostType(postTypeint) {
 		// 可选tag
-		if tagId != "" {
-			valid.Numeric(tagId, "tag_id")
+		valid.MaxSize(tagIds, setting.AppSetting.MaxPostTags, "tag_ids")
+		for _, tagId := range tagIds {
+			valid.Numeric(tagId, "tag_ids")
 		}
 	}
 	ok, verr = r.ErrorValid(&valid, "Add posts")
@@ -167,6 +196,11 @@ func AddPost(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, "缺失图片或内容")
 		return
 	}
+	// 只接受上传过的图片
+	if err := models.ValidImageUrls(imageURLs); err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
 	intuid := util.AsUint(uid)
 	maps := map[string]interface{}{
 		"uid":        intuid,
@@ -178,8 +212,18 @@ func AddPost(c *gin.Context) {
 	}
 	if postTypeint == POST_SCHOOL_TYPE {
 		maps["department_id"] = util.AsUint(departId)
-	} else if tagId != "" {
-		maps["tag_id"] = tagId
+	} else if len(tagIds) > 0 {
+		maps["tag_ids"] = util.AsUints(tagIds)
+	}
+	// 检查与最近的帖子是否重复
+	dup, err := models.CheckDuplicatePost(intuid, title, content)
+	if err != nil {
+		logging.Error("Check duplicate post error: %v", err)
+	}
+	if handleDuplicate(c, dup, func(d *models.DuplicateResult) (uint64, error) {
+		return models.HoldPost(maps, d)
+	}) {
+		return
 	}
 	id, err := models.AddPost(maps)
 	if err != nil {
@@ -196,6 +240,9 @@ func AddPost(c *gin.Context) {
 	}
 	data := make(map[string]interface{})
 	data["id"] = id
+	if dup != nil {
+		data["duplicate"] = dup
+	}
 	r.OK(c, e.SUCCESS, data)
 }
 
@@ -326,6 +373,97 @@ func FavOrUnfavPost(c *gin.Context) {
 	r.OK(c, e.SUCCESS, map[string]interface{}{"count": cnt})
 }
 
+// @method [get]
+// @way [query]
+// @param page page_size
+// @return postList, 每个帖子带有推荐理由reasons
+// @route /f/posts/recommend
+func GetRecommendPosts(c *gin.Context) {
+	uid := r.GetUid(c)
+
+	list, err := models.GetRecommendPosts(c, uid)
+	if err != nil {
+		logging.Error("Get recommend posts error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	for i := range list {
+		list[i].Uid = crypto.Encrypt(list[i].Uid, list[i].Id)
+	}
+	data := make(map[string]interface{})
+	data["list"] = list
+	data["total"] = len(list)
+
+	r.OK(c, e.SUCCESS, data)
+}
+
+// @method [post]
+// @way [formdata]
+// @param post_id, op
+// @return nil
+// @route /f/post/mute
+func MuteOrUnmutePost(c *gin.Context) {
+	uid := r.GetUid(c)
+	postId := c.PostForm("post_id")
+	op := c.PostForm("op")
+	valid := validation.Validation{}
+	valid.Required(postId, "postId")
+	valid.Numeric(postId, "postId")
+	valid.Required(op, "op")
+	valid.Numeric(op, "op")
+	ok, verr := r.ErrorValid(&valid, "mute or unmute post")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+
+	var err error
+	if op == "1" {
+		err = models.MutePost(util.AsUint(uid), util.AsUint(postId))
+	} else {
+		err = models.UnmutePost(util.AsUint(uid), util.AsUint(postId))
+	}
+	if err != nil {
+		logging.Error("mute or unmute post error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
+// @method [post]
+// @way [formdata]
+// @param post_id, add_tag_ids, remove_tag_ids
+// @return nil
+// @route /f/post/tags
+func EditPostTags(c *gin.Context) {
+	uid := r.GetUid(c)
+	postId := c.PostForm("post_id")
+	addIds := c.PostFormArray("add_tag_ids")
+	removeIds := c.PostFormArray("remove_tag_ids")
+	valid := validation.Validation{}
+	valid.Required(postId, "postId")
+	valid.Numeric(postId, "postId")
+	for _, id := range addIds {
+		valid.Numeric(id, "add_tag_ids")
+	}
+	for _, id := range removeIds {
+		valid.Numeric(id, "remove_tag_ids")
+	}
+	ok, verr := r.ErrorValid(&valid, "Edit post tags")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+	err := models.EditPostTags(uid, postId, util.AsUints(addIds), util.AsUints(removeIds))
+	if err != nil {
+		logging.Error("Edit post tags error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
+
 // @method [post]
 // @way [formdata]
 // @param post_id, op
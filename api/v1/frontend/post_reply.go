@@ -53,6 +53,11 @@ func AddPostReply(c *gin.Context) {
 		r.Error(c, e.INVALID_PARAMS, "缺失图片或内容")
 		return
 	}
+	// 只接受上传过的图片
+	if err := models.ValidImageUrls(imageURLs); err != nil {
+		r.Error(c, e.INVALID_PARAMS, err.Error())
+		return
+	}
 	// 添加回复
 	_, err = models.AddPostReply(map[string]interface{}{
 		"post_id": util.AsUint(postId),
@@ -150,3 +150,55 @@ func DeleteTag(c *gin.Context) {
 	}
 	r.OK(c, e.SUCCESS, nil)
 }
+
+// @method [get]
+// @way [query]
+// @param
+// @return tagList
+// @route /f/tags/following
+func GetFollowedTags(c *gin.Context) {
+	uid := r.GetUid(c)
+	list, err := models.GetFollowedTags(util.AsUint(uid))
+	if err != nil {
+		logging.Error("Get followed tags error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"list": list, "total": len(list)})
+}
+
+// @method [post]
+// @way [formdata]
+// @param tag_id, op, notify
+// @return
+// @route /f/tag/follow
+func FollowOrUnfollowTag(c *gin.Context) {
+	uid := r.GetUid(c)
+	tagId := c.PostForm("tag_id")
+	op := c.PostForm("op")
+	notify := c.DefaultPostForm("notify", "0")
+	valid := validation.Validation{}
+	valid.Required(tagId, "tag_id")
+	valid.Numeric(tagId, "tag_id")
+	valid.Required(op, "op")
+	valid.Numeric(op, "op")
+	valid.Numeric(notify, "notify")
+	ok, verr := r.ErrorValid(&valid, "Follow or unfollow tag")
+	if !ok {
+		r.Error(c, e.INVALID_PARAMS, verr.Error())
+		return
+	}
+
+	var err error
+	if op == "1" {
+		err = models.FollowTag(util.AsUint(uid), util.AsUint(tagId), notify == "1")
+	} else {
+		err = models.UnfollowTag(util.AsUint(uid), util.AsUint(tagId))
+	}
+	if err != nil {
+		logging.Error("Follow or unfollow tag error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	r.OK(c, e.SUCCESS, nil)
+}
@@ -4,6 +4,8 @@ import (
 	"qnhd/enums/IdentityType"
 	"qnhd/middleware/jwt"
 	"qnhd/middleware/permission"
+	"qnhd/middleware/ratelimit"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,6 +24,8 @@ const (
 	PostType
 	Banner
 	User
+	Notification
+	Upload
 )
 
 var FrontTypes = [...]FrontType{
@@ -36,14 +40,21 @@ var FrontTypes = [...]FrontType{
 	PostType,
 	Banner,
 	User,
+	Notification,
+	Upload,
 }
 
 func Setup(g *gin.RouterGroup) {
 	// 获取token
 	g.GET("/auth/passwd", GetAuthPasswd)
 	g.GET("/auth/token", GetAuthToken)
-	g.GET("/auth/:token", RefreshToken)
+	g.POST("/auth/refresh", RefreshSession)
+	g.POST("/auth/totp/login", LoginTotp)
 	g.Use(jwt.JWT())
+	// 登录会话管理
+	g.GET("/auth/sessions", GetSessions)
+	g.POST("/auth/logout", Logout)
+	g.POST("/auth/logout/all", LogoutAll)
 	g.Use(permission.IdentityDemand(IdentityType.USER))
 	// 封号的话不能访问
 	g.Use(permission.ValidBanned())
@@ -52,19 +63,24 @@ func Setup(g *gin.RouterGroup) {
 	}
 }
 
+// 写操作按用户和操作限流，管理员不受限制
 func initType(g *gin.RouterGroup, t FrontType) {
 	switch t {
 	case Tag:
 		// 查询标签
 		g.GET("/tags", GetTags)
 		// 新建标签
-		g.POST("/tag", AddTag)
+		g.POST("/tag", ratelimit.Limit(ratelimit.ADD_TAG, 10, time.Hour), AddTag)
 		// 删除指定标签
 		g.GET("/tag/delete", DeleteTag)
 		// 获取热议标签
 		g.GET("/tags/hot", GetHotTag)
 		// 获取推荐标签
 		g.GET("/tag/recommend", GetRecommendTag)
+		// 获取关注的标签
+		g.GET("/tags/following", GetFollowedTags)
+		// 关注或取消关注标签
+		g.POST("/tag/follow", FollowOrUnfollowTag)
 	case Post:
 		// 查询多个帖子
 		g.GET("/posts", GetPosts())
@@ -74,22 +90,30 @@ func initType(g *gin.RouterGroup, t FrontType) {
 		g.GET("/posts/fav", GetFavPosts)
 		// 查询历史帖子
 		g.GET("/posts/history", GetHistoryPosts)
+		// 个性化推荐
+		g.GET("/posts/recommend", GetRecommendPosts)
+		// 获取关注标签下的帖子
+		g.GET("/posts/following", GetFollowingPosts)
 		// 查询单个帖子
 		g.GET("/post", GetPost())
 		// 新建帖子
-		g.POST("/post", permission.ValidBlocked(), AddPost)
+		g.POST("/post", permission.ValidBlocked(), ratelimit.Cooldown(ratelimit.POST_COOL), ratelimit.Limit(ratelimit.ADD_POST, 10, time.Hour), AddPost)
 		// 解决问题
 		g.POST("/post/solve", EditPostSolved)
+		// 修改帖子的tag
+		g.POST("/post/tags", EditPostTags)
 		// 获取帖子回复
 		g.GET("/post/replys", GetPostReplys)
 		// 帖子回复校方回应
-		g.POST("/post/reply", AddPostReply)
+		g.POST("/post/reply", ratelimit.Limit(ratelimit.ADD_REPLY, 10, time.Minute), AddPostReply)
 		// 收藏或者取消
-		g.POST("/post/fav", FavOrUnfavPost)
+		g.POST("/post/fav", ratelimit.Limit(ratelimit.REACT, 60, time.Minute), FavOrUnfavPost)
 		// 点赞或者取消
-		g.POST("/post/like", LikeOrUnlikePost)
+		g.POST("/post/like", ratelimit.Limit(ratelimit.REACT, 60, time.Minute), LikeOrUnlikePost)
 		// 点踩或者取消
-		g.POST("/post/dis", DisOrUndisPost)
+		g.POST("/post/dis", ratelimit.Limit(ratelimit.REACT, 60, time.Minute), DisOrUndisPost)
+		// 屏蔽或取消屏蔽帖子的通知
+		g.POST("/post/mute", MuteOrUnmutePost)
 		// 访问记录
 		g.POST("/post/visit", VisitPost)
 		// 删除指定帖子
@@ -102,21 +126,28 @@ func initType(g *gin.RouterGroup, t FrontType) {
 		// 查询楼层内回复
 		g.GET("/floor/replys", GetFloorReplys)
 		// 新建楼层
-		g.POST("/floor", permission.ValidBlocked(), AddFloor)
+		g.POST("/floor", permission.ValidBlocked(), ratelimit.Limit(ratelimit.ADD_FLOOR, 20, time.Minute), AddFloor)
 		// 回复楼层
-		g.POST("/floor/reply", permission.ValidBlocked(), ReplyFloor)
+		g.POST("/floor/reply", permission.ValidBlocked(), ratelimit.Limit(ratelimit.ADD_FLOOR, 20, time.Minute), ReplyFloor)
 		//  点赞或者取消
-		g.POST("/floor/like", LikeOrUnlikeFloor)
+		g.POST("/floor/like", ratelimit.Limit(ratelimit.REACT, 60, time.Minute), LikeOrUnlikeFloor)
 		//  点踩或者取消
-		g.POST("/floor/dis", DisOrUndisFloor)
+		g.POST("/floor/dis", ratelimit.Limit(ratelimit.REACT, 60, time.Minute), DisOrUndisFloor)
 		// 删除指定楼层
 		g.GET("/floor/delete", DeleteFloor)
+	case History:
+		// 删除一条浏览记录
+		g.GET("/history/delete", DeleteHistory)
+		// 清空浏览记录
+		g.GET("/history/clear", ClearHistory)
+		// 开关浏览记录
+		g.POST("/history/setting", EditHistorySetting)
 	case Department:
 		// 查询部门
 		g.GET("/departments", GetDepartments)
 	case Report:
 		// 添加举报
-		g.POST("/report", AddReport)
+		g.POST("/report", ratelimit.Limit(ratelimit.ADD_REPORT, 10, time.Hour), AddReport)
 	case Message:
 		// 获取未读楼层
 		g.GET("/message/floors", GetMessageFloors)
@@ -130,6 +161,8 @@ func initType(g *gin.RouterGroup, t FrontType) {
 		g.GET("/message/likes", GetMessageLikes)
 		// 获取未读数量
 		g.GET("/message/count", GetMessageCount)
+		// 实时消息推送
+		g.GET("/message/stream", GetMessageStream)
 		// 已读通知
 		g.POST("/message/notice/read", ReadNotice)
 		// 删除通知记录
@@ -144,6 +177,12 @@ func initType(g *gin.RouterGroup, t FrontType) {
 		g.POST("/message/like/read", ReadLike)
 		// 全部已读
 		g.POST("/message/all", ReadAllMessage)
+		// 消息中心，合并所有类型的消息
+		g.GET("/inbox", GetInbox)
+		// 批量已读
+		g.POST("/inbox/read", ReadInboxItems)
+		// 批量删除
+		g.POST("/inbox/delete", DeleteInboxItems)
 	case Game:
 		// 获取游戏列表
 		g.GET("/game", GetNewestGame)
@@ -158,5 +197,13 @@ func initType(g *gin.RouterGroup, t FrontType) {
 		g.GET("/user", GetUserInfo)
 		// 修改昵称
 		g.POST("/user/name", EditUserName)
+	case Notification:
+		// 获取通知偏好
+		g.GET("/notification/preferences", GetNotificationPreferences)
+		// 修改通知偏好
+		g.POST("/notification/preference", EditNotificationPreference)
+	case Upload:
+		// 上传图片
+		g.POST("/upload/image", ratelimit.Limit(ratelimit.UPLOAD, 30, time.Minute), UploadImage)
 	}
 }
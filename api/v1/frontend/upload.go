@@ -0,0 +1,97 @@
+package frontend
+
+import (
+	"io/ioutil"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/upload"
+	"qnhd/pkg/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @method [post]
+// @way [formdata]
+// @param image
+// @return image
+// @route /f/upload/image
+func UploadImage(c *gin.Context) {
+	uid := r.GetUid(c)
+	header, err := c.FormFile("image")
+	if err != nil {
+		r.Error(c, e.INVALID_PARAMS, "缺少图片")
+		return
+	}
+	if !upload.CheckImageExt(header.Filename) {
+		r.Error(c, e.ERROR_CHECK_IMAGE_FORMAT, header.Filename)
+		return
+	}
+	if !upload.CheckImageSize(int(header.Size)) {
+		r.Error(c, e.ERROR_CHECK_IMAGE_SIZE, "")
+		return
+	}
+	f, err := header.Open()
+	if err != nil {
+		r.Error(c, e.ERROR_SAVE_FILE, err.Error())
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		r.Error(c, e.ERROR_SAVE_FILE, err.Error())
+		return
+	}
+	if !upload.CheckImageSize(len(data)) {
+		r.Error(c, e.ERROR_CHECK_IMAGE_SIZE, "")
+		return
+	}
+
+	// 相同内容直接返回
+	img, err := models.GetImageByHash(upload.HashImage(data))
+	if err != nil {
+		logging.Error("Upload image error: %v", err)
+		r.Error(c, e.ERROR_DATABASE, err.Error())
+		return
+	}
+	if img.TakenDown {
+		r.Error(c, e.ERROR_CHECK_IMAGE_FORMAT, "该图片已被下架")
+		return
+	}
+	if img.Hash != "" {
+		if err := models.TouchImage(img.Hash); err != nil {
+			logging.Error("Upload image error: %v", err)
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+			return
+		}
+	} else {
+		p, err := upload.ProcessImage(data)
+		if err != nil {
+			r.Error(c, e.ERROR_CHECK_IMAGE_FORMAT, err.Error())
+			return
+		}
+		urls, err := upload.SaveImage(p)
+		if err != nil {
+			logging.Error("Save image error: %v", err)
+			r.Error(c, e.ERROR_SAVE_FILE, err.Error())
+			return
+		}
+		img = models.Image{
+			Hash:      p.Hash,
+			Uid:       util.AsUint(uid),
+			Url:       urls.Url,
+			ThumbUrl:  urls.ThumbUrl,
+			MediumUrl: urls.MediumUrl,
+			Width:     p.Width,
+			Height:    p.Height,
+			Size:      len(p.Original),
+		}
+		if err := models.AddImage(&img); err != nil {
+			logging.Error("Upload image error: %v", err)
+			r.Error(c, e.ERROR_DATABASE, err.Error())
+			return
+		}
+	}
+	r.OK(c, e.SUCCESS, map[string]interface{}{"image": img})
+}
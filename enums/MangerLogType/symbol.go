@@ -33,6 +33,22 @@ var msgSymbol = map[Enum]string{
 	TAG_POINT_ADD:   "tag_point_add",
 	TAG_POINT_CLEAR: "tag_point_clear",
 	TAG_DELETE:      "tag_delete",
+	TAG_MERGE:       "tag_merge",
+
+	TAG_HOT_CONFIG_EDIT: "tag_hot_config_edit",
+
+	IMAGE_TAKE_DOWN: "image_take_down",
+
+	HELD_CONTENT_APPROVE: "held_content_approve",
+	HELD_CONTENT_REJECT:  "held_content_reject",
+
+	ROLE_ADD:         "role_add",
+	ROLE_EDIT:        "role_edit",
+	ROLE_DELETE:      "role_delete",
+	USER_ROLE_ADD:    "user_role_add",
+	USER_ROLE_DELETE: "user_role_delete",
+
+	USER_TOTP_RESET: "user_totp_reset",
 }
 
 func (code Enum) GetSymbol() string {
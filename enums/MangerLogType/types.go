@@ -35,4 +35,19 @@ const (
 	TAG_POINT_ADD
 	TAG_POINT_CLEAR
 	TAG_DELETE
+	TAG_MERGE
+	TAG_HOT_CONFIG_EDIT
+
+	IMAGE_TAKE_DOWN
+
+	HELD_CONTENT_APPROVE
+	HELD_CONTENT_REJECT
+
+	ROLE_ADD
+	ROLE_EDIT
+	ROLE_DELETE
+	USER_ROLE_ADD
+	USER_ROLE_DELETE
+
+	USER_TOTP_RESET
 )
@@ -9,6 +9,10 @@ var templateArgs = map[Enum][]string{
 	FLOOR_DELETED:            {"post", "floor"},
 	POST_TYPE_TRANSFER:       {"from_type", "post", "to_type"},
 	POST_DEPARTMENT_TRANSFER: {"post", "department"},
+	POST_LIKE_MILESTONE:      {"post", "count"},
+	FLOOR_LIKE_MILESTONE:     {"post", "floor", "count"},
+	FOLLOWED_TAG_NEW_POST:    {"tag", "post"},
+	IMAGE_TAKEN_DOWN:         {"post", "reason"},
 }
 
 func (code Enum) GetArgs() []string {
@@ -9,8 +9,22 @@ var msgSymbol = map[Enum]string{
 	FLOOR_DELETED:            "floor_deleted",
 	POST_TYPE_TRANSFER:       "post_type_transfer",
 	POST_DEPARTMENT_TRANSFER: "post_department_transfer",
+	POST_LIKE_MILESTONE:      "post_like_milestone",
+	FLOOR_LIKE_MILESTONE:     "floor_like_milestone",
+	FOLLOWED_TAG_NEW_POST:    "followed_tag_new_post",
+	IMAGE_TAKEN_DOWN:         "image_taken_down",
 }
 
 func (code Enum) GetSymbol() string {
 	return msgSymbol[code]
 }
+
+// 根据symbol找到通知类型
+func FromSymbol(symbol string) (Enum, bool) {
+	for k, v := range msgSymbol {
+		if v == symbol {
+			return k, true
+		}
+	}
+	return 0, false
+}
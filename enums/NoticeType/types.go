@@ -11,4 +11,23 @@ const (
 	FLOOR_DELETED
 	POST_TYPE_TRANSFER
 	POST_DEPARTMENT_TRANSFER
+	POST_LIKE_MILESTONE
+	FLOOR_LIKE_MILESTONE
+	FOLLOWED_TAG_NEW_POST
+	IMAGE_TAKEN_DOWN
 )
+
+var All = []Enum{
+	FLOOR_REPORT_SOLVE,
+	POST_REPORT_SOLVE,
+	POST_VALUED,
+	BEEN_BLOCKED,
+	POST_DELETED,
+	FLOOR_DELETED,
+	POST_TYPE_TRANSFER,
+	POST_DEPARTMENT_TRANSFER,
+	POST_LIKE_MILESTONE,
+	FLOOR_LIKE_MILESTONE,
+	FOLLOWED_TAG_NEW_POST,
+	IMAGE_TAKEN_DOWN,
+}
@@ -0,0 +1,14 @@
+package NotificationEventType
+
+var msgSymbol = map[Enum]string{
+	FLOOR_ON_POST:     "floor_on_post",
+	REPLY_TO_FLOOR:    "reply_to_floor",
+	FAV_POST_ACTIVITY: "fav_post_activity",
+	LIKE:              "like",
+	NOTICE:            "notice",
+	FOLLOWED_TAG_POST: "followed_tag_post",
+}
+
+func (code Enum) GetSymbol() string {
+	return msgSymbol[code]
+}
@@ -0,0 +1,36 @@
+package NotificationEventType
+
+type Enum int
+
+const (
+	// 帖子下的新楼层
+	FLOOR_ON_POST Enum = iota
+	// 楼层被回复
+	REPLY_TO_FLOOR
+	// 收藏帖子有新动态
+	FAV_POST_ACTIVITY
+	// 点赞
+	LIKE
+	// 通知
+	NOTICE
+	// 关注的tag有新帖
+	FOLLOWED_TAG_POST
+)
+
+var All = []Enum{
+	FLOOR_ON_POST,
+	REPLY_TO_FLOOR,
+	FAV_POST_ACTIVITY,
+	LIKE,
+	NOTICE,
+	FOLLOWED_TAG_POST,
+}
+
+func (code Enum) IsValid() bool {
+	return code >= FLOOR_ON_POST && code <= FOLLOWED_TAG_POST
+}
+
+// 通知中包含管理处理结果，站内消息不可关闭
+func (code Enum) CanDisableInApp() bool {
+	return code != NOTICE
+}
@@ -0,0 +1,54 @@
+package PermissionType
+
+var msgSymbol = map[Enum]string{
+	USER_BAN:    "user.ban",
+	USER_BLOCK:  "user.block",
+	USER_MANAGE: "user.manage",
+	USER_DETAIL: "user.detail",
+
+	NOTICE_PUBLISH:   "notice.publish",
+	NOTICE_BROADCAST: "notice.broadcast",
+
+	POST_DELETE:     "post.delete",
+	POST_RECOVER:    "post.recover",
+	POST_REPLY:      "post.reply",
+	POST_TRANSFER:   "post.transfer",
+	POST_DISTRIBUTE: "post.distribute",
+	POST_FEATURE:    "post.feature",
+	POST_MODERATE:   "post.moderate",
+
+	FLOOR_DELETE:  "floor.delete",
+	FLOOR_RECOVER: "floor.recover",
+
+	DEPARTMENT_ALL:    "department.all",
+	DEPARTMENT_MANAGE: "department.manage",
+
+	TAG_MANAGE:       "tag.manage",
+	GAME_MANAGE:      "game.manage",
+	SENSITIVE_MANAGE: "sensitive.manage",
+	POST_TYPE_MANAGE: "post_type.manage",
+	RETENTION_MANAGE: "retention.manage",
+	ROLE_MANAGE:      "role.manage",
+}
+
+func (code Enum) GetSymbol() string {
+	return msgSymbol[code]
+}
+
+func FromSymbol(symbol string) (Enum, bool) {
+	for k, v := range msgSymbol {
+		if v == symbol {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// 所有权限
+func All() []Enum {
+	var list []Enum
+	for k := USER_BAN; k <= ROLE_MANAGE; k++ {
+		list = append(list, k)
+	}
+	return list
+}
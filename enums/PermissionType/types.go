@@ -0,0 +1,39 @@
+package PermissionType
+
+type Enum int
+
+const (
+	USER_BAN Enum = iota
+	USER_BLOCK
+	// 新建管理员、修改密码和部门
+	USER_MANAGE
+	USER_DETAIL
+
+	NOTICE_PUBLISH
+	// 发布全站公告、指定受众，没有时只能发布部门公告
+	NOTICE_BROADCAST
+
+	POST_DELETE
+	POST_RECOVER
+	POST_REPLY
+	POST_TRANSFER
+	POST_DISTRIBUTE
+	// 加精和额外标签
+	POST_FEATURE
+	// 下架图片和审核暂扣内容
+	POST_MODERATE
+
+	FLOOR_DELETE
+	FLOOR_RECOVER
+
+	// 不限部门处理校务帖子，没有时只能处理所在部门的
+	DEPARTMENT_ALL
+	DEPARTMENT_MANAGE
+
+	TAG_MANAGE
+	GAME_MANAGE
+	SENSITIVE_MANAGE
+	POST_TYPE_MANAGE
+	RETENTION_MANAGE
+	ROLE_MANAGE
+)
@@ -0,0 +1,21 @@
+package PostSearchModeType
+
+var modeSymbol = map[Enum]string{
+	TIME:     "time",
+	UPDATE:   "update",
+	TRENDING: "trending",
+}
+
+func (code Enum) GetSymbol() string {
+	return modeSymbol[code]
+}
+
+// 根据symbol找到搜索方式
+func FromSymbol(symbol string) (Enum, bool) {
+	for k, v := range modeSymbol {
+		if v == symbol {
+			return k, true
+		}
+	}
+	return 0, false
+}
@@ -5,4 +5,5 @@ type Enum int
 const (
 	TIME Enum = iota
 	UPDATE
+	TRENDING
 )
@@ -0,0 +1,43 @@
+package TagPointType
+
+var msgSymbol = map[Enum]string{
+	ADD_POST:  "add_post",
+	ADD_FLOOR: "add_floor",
+
+	LIKE_POST: "like_post",
+	FAV_POST:  "fav_post",
+	DIS_POST:  "dis_post",
+
+	UNLIKE_POST: "unlike_post",
+	UNFAV_POST:  "unfav_post",
+	UNDIS_POST:  "undis_post",
+
+	LIKE_FLOOR: "like_floor",
+	DIS_FLOOR:  "dis_floor",
+
+	UNLIKE_FLOOR: "unlike_floor",
+	UNDIS_FLOOR:  "undis_floor",
+
+	MANUAL: "manual",
+}
+
+func (code Enum) GetSymbol() string {
+	return msgSymbol[code]
+}
+
+// 取消操作对应的操作
+func (code Enum) Undo() (Enum, bool) {
+	switch code {
+	case UNLIKE_POST:
+		return LIKE_POST, true
+	case UNFAV_POST:
+		return FAV_POST, true
+	case UNDIS_POST:
+		return DIS_POST, true
+	case UNLIKE_FLOOR:
+		return LIKE_FLOOR, true
+	case UNDIS_FLOOR:
+		return DIS_FLOOR, true
+	}
+	return code, false
+}
@@ -2,21 +2,25 @@ package TagPointType
 
 type Enum int
 
+// 权重在配置中，取消操作按对应操作的权重扣除
 const (
-	ADD_POST  Enum = 20
-	ADD_FLOOR Enum = 10
+	ADD_POST Enum = iota
+	ADD_FLOOR
 
-	LIKE_POST Enum = 4
-	FAV_POST  Enum = 3
-	DIS_POST  Enum = 4
+	LIKE_POST
+	FAV_POST
+	DIS_POST
 
-	UNLIKE_POST Enum = -4
-	UNFAV_POST  Enum = -3
-	UNDIS_POST  Enum = -4
+	UNLIKE_POST
+	UNFAV_POST
+	UNDIS_POST
 
-	LIKE_FLOOR Enum = 1
-	DIS_FLOOR  Enum = 1
+	LIKE_FLOOR
+	DIS_FLOOR
 
-	UNLIKE_FLOOR Enum = -1
-	UNDIS_FLOOR  Enum = -1
+	UNLIKE_FLOOR
+	UNDIS_FLOOR
+
+	// 管理员手动增加
+	MANUAL
 )
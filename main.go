@@ -8,6 +8,7 @@ import (
 	"qnhd/pkg/logging"
 	"qnhd/pkg/segment"
 	"qnhd/pkg/setting"
+	"qnhd/pkg/stream"
 )
 
 func main() {
@@ -15,18 +16,37 @@ func main() {
 	segment.Setup()
 	logging.Setup()
 	setupModels()
+	checkNoticeTemplates()
 	filter.Setup()
 	refreshToken()
 	cronic.Setup()
+	stream.Setup()
 	api.Setup()
 
 	defer models.Close()
 	defer api.Close()
 	defer cronic.Close()
+	defer stream.Close()
 }
 
 func setupModels() {
 	models.Setup(setting.EnvironmentSetting.DB_DEBUG == "1")
+	// 内置角色和管理员标记迁移
+	if err := models.SetupRoles(); err != nil {
+		logging.Error("setup roles error: %v", err)
+	}
+	// 新增的系统通知模板
+	if err := models.SetupNoticeTemplates(); err != nil {
+		logging.Error("setup notice templates error: %v", err)
+	}
+	// 指定受众的广播通知补充接收者
+	if err := models.SetupNoticeRecipients(); err != nil {
+		logging.Error("setup notice recipients error: %v", err)
+	}
+	// 后台修改过的tag热度参数
+	if err := models.LoadTagHotConfig(); err != nil {
+		logging.Error("load tag hot config error: %v", err)
+	}
 }
 
 func refreshToken() {
@@ -34,5 +54,18 @@ func refreshToken() {
 		// 更新未处理的数据
 		models.FlushPostsTokens(false)
 		models.FlushTagsTokens(false)
+		models.FlushUserVisitHistory()
+		models.FlushPostVisitCounts()
+	}
+}
+
+func checkNoticeTemplates() {
+	missing, err := models.CheckNoticeTemplates()
+	if err != nil {
+		logging.Error("check notice templates error: %v", err)
+		return
+	}
+	for _, symbol := range missing {
+		logging.Warn("notice template missing: %s", symbol)
 	}
 }
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/r"
@@ -28,6 +29,9 @@ func JWT() gin.HandlerFunc {
 			} else if time.Now().Unix() > claims.ExpiresAt {
 				// 是否过期
 				code = e.ERROR_AUTH_CHECK_TOKEN_TIMEOUT
+			} else if !models.IsSessionActive(claims.Sid) {
+				// 会话已注销
+				code = e.ERROR_AUTH_SESSION_REVOKED
 			}
 		}
 
@@ -1,6 +1,7 @@
 package permission
 
 import (
+	"qnhd/enums/PermissionType"
 	"qnhd/models"
 	"qnhd/pkg/e"
 	"qnhd/pkg/r"
@@ -8,11 +9,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func RightDemand(right models.UserRight) gin.HandlerFunc {
+// 需要在任意范围内拥有权限，具体范围由接口检查
+func RightDemand(perm PermissionType.Enum) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		uid := r.GetUid(c)
-		if !models.RequireRight(uid, right) {
-			r.Error(c, e.ERROR_RIGHT, "")
+		if !models.HasPermission(uid, perm) {
+			r.Error(c, e.ERROR_RIGHT, perm.GetSymbol())
 			c.Abort()
 			return
 		}
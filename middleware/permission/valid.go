@@ -45,3 +45,42 @@ func ValidBlocked() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// 重置密码后需要先修改密码
+func ValidPasswordChanged() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := r.GetUid(c)
+		if models.MustChangePassword(uid) {
+			r.OK(c, e.ERROR_MUST_CHANGE_PASSWORD, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 角色要求两步验证时需要先开启
+func ValidTotpEnrolled() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := util.AsUint(r.GetUid(c))
+		if models.IsTotpRequired(uid) && !models.IsTotpEnabled(uid) {
+			r.OK(c, e.ERROR_TOTP_NOT_ENROLLED, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 敏感操作要求当前会话最近完成过两步验证，未开启两步验证的不检查
+func RecentTotp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uid := util.AsUint(r.GetUid(c))
+		if models.IsTotpEnabled(uid) && !models.IsSessionTotpRecent(r.GetSid(c)) {
+			r.OK(c, e.ERROR_TOTP_RECENT_REQUIRED, nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
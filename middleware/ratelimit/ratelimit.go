@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"math"
+	"qnhd/models"
+	"qnhd/pkg/e"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/r"
+	"qnhd/pkg/ratelimit"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/util"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 限流的操作
+const (
+	ADD_POST   = "add_post"
+	POST_COOL  = "post_cooldown"
+	ADD_FLOOR  = "add_floor"
+	ADD_REPLY  = "add_reply"
+	ADD_TAG    = "add_tag"
+	ADD_REPORT = "add_report"
+	REACT      = "react"
+	UPLOAD     = "upload"
+)
+
+// 每period内最多burst次
+func Limit(action string, burst int, period time.Duration) gin.HandlerFunc {
+	rule := ratelimit.Rule{Action: action, Burst: burst, Period: period}
+	return func(c *gin.Context) {
+		check(c, rule)
+	}
+}
+
+// 发帖间隔，使用配置的TimeLimit秒数
+func Cooldown(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !setting.AppSetting.EnableTimeLimit || setting.AppSetting.TimeLimit <= 0 {
+			c.Next()
+			return
+		}
+		check(c, ratelimit.Rule{Action: action, Burst: 1, Period: time.Duration(setting.AppSetting.TimeLimit) * time.Second})
+	}
+}
+
+func check(c *gin.Context, rule ratelimit.Rule) {
+	if !setting.RateLimitSetting.Enable {
+		c.Next()
+		return
+	}
+	uid := r.GetUid(c)
+	ok, wait, err := take(util.AsUint(uid), rule)
+	if err != nil {
+		// 计数出错时不影响正常使用
+		logging.Error("rate limit error: %v", err)
+		c.Next()
+		return
+	}
+	// 管理员不受限制
+	if ok || models.RequireAdmin(uid) == nil {
+		c.Next()
+		return
+	}
+	seconds := int(math.Max(1, wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	r.OK(c, e.ERROR_RATE_LIMIT, map[string]interface{}{
+		"retry_after": seconds,
+	})
+	c.Abort()
+}
+
+func take(uid uint64, rule ratelimit.Rule) (bool, time.Duration, error) {
+	if setting.RateLimitSetting.Store == "database" {
+		return models.TakeRateToken(uid, rule)
+	}
+	ok, wait := ratelimit.Memory.Take(uid, rule)
+	return ok, wait, nil
+}
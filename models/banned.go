@@ -3,6 +3,7 @@ package models
 import (
 	"errors"
 	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/pkg/logging"
 
 	"gorm.io/gorm"
 )
@@ -39,6 +40,10 @@ func AddBannedByUid(uid uint64, doer uint64, reason string) (uint64, error) {
 	}
 
 	addManagerLog(doer, uid, ManagerLogType.USER_BAN)
+	// 封号后注销全部登录
+	if err := RevokeUserSessions(uid, ""); err != nil {
+		logging.Error("revoke sessions error: %v", err)
+	}
 
 	return ban.Id, nil
 }
@@ -2,7 +2,6 @@ package models
 
 import (
 	"database/sql"
-	"fmt"
 	"qnhd/pkg/logging"
 	"qnhd/pkg/setting"
 	"time"
@@ -18,13 +17,7 @@ var sqlDB *sql.DB
 
 func Setup(debug bool) {
 	var err error
-	database := setting.DatabaseSetting.Database
-	user := setting.DatabaseSetting.User
-	password := setting.DatabaseSetting.Password
-	host := setting.DatabaseSetting.Host
-	port := setting.DatabaseSetting.Port
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai", host,
-		user, password, database, port)
+	dsn := setting.DatabaseSetting.DSN()
 
 	var logLevel logger.LogLevel
 	if debug {
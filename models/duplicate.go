@@ -0,0 +1,342 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/enums/PostCampusType"
+	"qnhd/enums/ReportType"
+	"qnhd/pkg/segment"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/simhash"
+	"qnhd/pkg/util"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	DUPLICATE_REJECT = "reject"
+	DUPLICATE_WARN   = "warn"
+	DUPLICATE_HOLD   = "hold"
+)
+
+// 一个帖子内最多对比的楼层数
+const duplicateFloorLimit = 500
+
+// 内容指纹保留的天数
+const contentHashDays = 30
+
+// 帖子和楼层内容的SimHash
+type ContentHash struct {
+	Kind      ReportType.Enum `json:"type"`
+	ObjectId  uint64          `json:"object_id"`
+	Uid       uint64          `json:"-"`
+	PostId    uint64          `json:"post_id"`
+	Hash      int64           `json:"-"`
+	CreatedAt string          `json:"created_at" gorm:"autoCreateTime;default:null;"`
+}
+
+// 查到的相似内容
+type DuplicateResult struct {
+	Kind     ReportType.Enum `json:"type"`
+	Id       uint64          `json:"id"`
+	PostId   uint64          `json:"post_id"`
+	Distance int             `json:"distance"`
+}
+
+func contentTokens(text string) []string {
+	var tokens []string
+	for _, t := range strings.Split(segment.Cut(strings.ToLower(text), " "), " ") {
+		if t = strings.TrimSpace(t); t != "" {
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens
+}
+
+func contentHashOf(text string) int64 {
+	return int64(simhash.Hash(contentTokens(text)))
+}
+
+func postHashText(title, content string) string {
+	return title + " " + content
+}
+
+// 记录新发布内容的指纹
+func addContentHash(kind ReportType.Enum, objectId, uid, postId uint64, text string) error {
+	return db.Create(&ContentHash{
+		Kind:     kind,
+		ObjectId: objectId,
+		Uid:      uid,
+		PostId:   postId,
+		Hash:     contentHashOf(text),
+	}).Error
+}
+
+// 在候选中找到最相似的内容
+func findDuplicate(hash int64, candidates []ContentHash) *DuplicateResult {
+	var res *DuplicateResult
+	for _, ch := range candidates {
+		d := simhash.Distance(uint64(hash), uint64(ch.Hash))
+		if d > setting.DuplicateSetting.Distance {
+			continue
+		}
+		if res == nil || d < res.Distance {
+			res = &DuplicateResult{Kind: ch.Kind, Id: ch.ObjectId, PostId: ch.PostId, Distance: d}
+		}
+	}
+	return res
+}
+
+// 检查帖子是否与自己最近的帖子或全站最近的帖子重复
+func CheckDuplicatePost(uid uint64, title, content string) (*DuplicateResult, error) {
+	if !setting.DuplicateSetting.Enable {
+		return nil, nil
+	}
+	text := postHashText(title, content)
+	alive := db.Model(&Post{}).Select("id")
+	var candidates []ContentHash
+	if err := db.Where("kind = ? AND uid = ? AND object_id IN (?)", ReportType.POST, uid, alive).
+		Order("created_at DESC").Limit(setting.DuplicateSetting.UserRecentCount).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	// 太短的内容容易误判，只对比自己的
+	if len([]rune(text)) >= setting.DuplicateSetting.MinLength {
+		var site []ContentHash
+		from := time.Now().Add(-time.Duration(setting.DuplicateSetting.SiteHours) * time.Hour)
+		if err := db.Where("kind = ? AND uid <> ? AND created_at >= ? AND object_id IN (?)", ReportType.POST, uid, from, alive).
+			Find(&site).Error; err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, site...)
+	}
+	return findDuplicate(contentHashOf(text), candidates), nil
+}
+
+// 检查楼层是否与帖子内的楼层重复
+func CheckDuplicateFloor(uid, postId uint64, content string) (*DuplicateResult, error) {
+	if !setting.DuplicateSetting.Enable || content == "" {
+		return nil, nil
+	}
+	d := db.Where("kind = ? AND post_id = ? AND object_id IN (?)", ReportType.FLOOR, postId, db.Model(&Floor{}).Select("id"))
+	// 太短的内容容易误判，只对比自己的
+	if len([]rune(content)) < setting.DuplicateSetting.MinLength {
+		d = d.Where("uid = ?", uid)
+	}
+	var candidates []ContentHash
+	if err := d.Order("created_at DESC").Limit(duplicateFloorLimit).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	return findDuplicate(contentHashOf(content), candidates), nil
+}
+
+// 检查楼层回复，按回复的楼层找到帖子
+func CheckDuplicateReply(uid, floorId uint64, content string) (*DuplicateResult, error) {
+	var floor Floor
+	if err := db.Where("id = ?", floorId).First(&floor).Error; err != nil {
+		return nil, err
+	}
+	return CheckDuplicateFloor(uid, floor.PostId, content)
+}
+
+// 清理过期的内容指纹
+func FlushContentHashes() (int64, error) {
+	res := db.Where("created_at < ?", daysAgo(contentHashDays)).Delete(&ContentHash{})
+	return res.RowsAffected, res.Error
+}
+
+const (
+	HELD_PENDING = iota
+	HELD_APPROVED
+	HELD_REJECTED
+)
+
+// 因重复被暂扣，等待审核的内容
+type HeldContent struct {
+	Id      uint64          `json:"id" gorm:"primaryKey;autoIncrement;"`
+	Uid     uint64          `json:"uid"`
+	Kind    ReportType.Enum `json:"type"`
+	PostId  uint64          `json:"post_id"`
+	ReplyTo uint64          `json:"reply_to"`
+	Title   string          `json:"title"`
+	Content string          `json:"content"`
+	// 其他发布参数
+	Data string `json:"-"`
+	// 相似的内容
+	SimilarKind ReportType.Enum `json:"similar_type"`
+	SimilarId   uint64          `json:"similar_id"`
+	Status      int             `json:"status" gorm:"default:0"`
+	// 通过后发布的id
+	ObjectId   uint64 `json:"object_id" gorm:"default:0"`
+	ReviewerId uint64 `json:"reviewer_id" gorm:"default:0"`
+	CreatedAt  string `json:"created_at" gorm:"autoCreateTime;default:null;"`
+	UpdatedAt  string `json:"updated_at" gorm:"autoUpdateTime;default:null;"`
+}
+
+type heldData struct {
+	Type         int      `json:"type"`
+	Campus       int      `json:"campus"`
+	DepartmentId uint64   `json:"department_id"`
+	TagIds       []uint64 `json:"tag_ids"`
+	ImageUrls    []string `json:"image_urls"`
+}
+
+func (h *HeldContent) imageUrls() []string {
+	var data heldData
+	json.Unmarshal([]byte(h.Data), &data)
+	return data.ImageUrls
+}
+
+// 暂扣帖子，maps与AddPost相同
+func HoldPost(maps map[string]interface{}, dup *DuplicateResult) (uint64, error) {
+	data := heldData{
+		Type:   maps["type"].(int),
+		Campus: int(maps["campus"].(PostCampusType.Enum)),
+	}
+	data.DepartmentId, _ = maps["department_id"].(uint64)
+	data.TagIds, _ = maps["tag_ids"].([]uint64)
+	data.ImageUrls, _ = maps["image_urls"].([]string)
+	return holdContent(&HeldContent{
+		Uid:     maps["uid"].(uint64),
+		Kind:    ReportType.POST,
+		Title:   maps["title"].(string),
+		Content: maps["content"].(string),
+	}, data, dup)
+}
+
+// 暂扣楼层，maps与AddFloor或ReplyFloor相同
+func HoldFloor(maps map[string]interface{}, dup *DuplicateResult) (uint64, error) {
+	h := &HeldContent{
+		Uid:     maps["uid"].(uint64),
+		Kind:    ReportType.FLOOR,
+		PostId:  dup.PostId,
+		Content: maps["content"].(string),
+	}
+	h.ReplyTo, _ = maps["replyToFloor"].(uint64)
+	var data heldData
+	if url := maps["image_url"].(string); url != "" {
+		data.ImageUrls = []string{url}
+	}
+	return holdContent(h, data, dup)
+}
+
+func holdContent(h *HeldContent, data heldData, dup *DuplicateResult) (uint64, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	h.Data = string(b)
+	h.SimilarKind = dup.Kind
+	h.SimilarId = dup.Id
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(h).Error; err != nil {
+			return err
+		}
+		// 审核期间保留图片
+		return refImages(tx, data.ImageUrls, 1)
+	})
+	return h.Id, err
+}
+
+func GetHeldContents(c *gin.Context, status string) ([]HeldContent, error) {
+	var list = []HeldContent{}
+	d := db.Model(&HeldContent{})
+	if status != "" {
+		d = d.Where("status = ?", status)
+	}
+	err := d.Scopes(util.Paginate(c)).Order("id DESC").Find(&list).Error
+	return list, err
+}
+
+func getPendingHeldContent(id string) (*HeldContent, error) {
+	var h HeldContent
+	if err := db.Where("id = ?", id).First(&h).Error; err != nil {
+		return nil, err
+	}
+	if h.Status != HELD_PENDING {
+		return nil, fmt.Errorf("已审核")
+	}
+	return &h, nil
+}
+
+// 通过审核，正常发布
+func ApproveHeldContent(uid, id string) (uint64, error) {
+	h, err := getPendingHeldContent(id)
+	if err != nil {
+		return 0, err
+	}
+	var data heldData
+	if err := json.Unmarshal([]byte(h.Data), &data); err != nil {
+		return 0, err
+	}
+	var objectId uint64
+	if h.Kind == ReportType.POST {
+		maps := map[string]interface{}{
+			"uid":        h.Uid,
+			"type":       data.Type,
+			"campus":     PostCampusType.Enum(data.Campus),
+			"title":      h.Title,
+			"content":    h.Content,
+			"image_urls": data.ImageUrls,
+		}
+		if data.Type == POST_SCHOOL_TYPE {
+			maps["department_id"] = data.DepartmentId
+		} else if len(data.TagIds) > 0 {
+			maps["tag_ids"] = data.TagIds
+		}
+		objectId, err = AddPost(maps)
+	} else {
+		maps := map[string]interface{}{
+			"uid":       h.Uid,
+			"content":   h.Content,
+			"image_url": "",
+		}
+		if len(data.ImageUrls) > 0 {
+			maps["image_url"] = data.ImageUrls[0]
+		}
+		if h.ReplyTo > 0 {
+			maps["replyToFloor"] = h.ReplyTo
+			objectId, err = ReplyFloor(maps)
+		} else {
+			maps["postId"] = h.PostId
+			objectId, err = AddFloor(maps)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if err := reviewHeldContent(h, uid, HELD_APPROVED, objectId); err != nil {
+		return 0, err
+	}
+	addManagerLog(util.AsUint(uid), h.Id, ManagerLogType.HELD_CONTENT_APPROVE)
+	return objectId, nil
+}
+
+// 拒绝发布
+func RejectHeldContent(uid, id string) error {
+	h, err := getPendingHeldContent(id)
+	if err != nil {
+		return err
+	}
+	if err := reviewHeldContent(h, uid, HELD_REJECTED, 0); err != nil {
+		return err
+	}
+	return addManagerLog(util.AsUint(uid), h.Id, ManagerLogType.HELD_CONTENT_REJECT)
+}
+
+func reviewHeldContent(h *HeldContent, uid string, status int, objectId uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&HeldContent{}).Where("id = ?", h.Id).Updates(map[string]interface{}{
+			"status":      status,
+			"object_id":   objectId,
+			"reviewer_id": util.AsUint(uid),
+		}).Error; err != nil {
+			return err
+		}
+		// 发布后的内容自己计入引用
+		return refImages(tx, h.imageUrls(), -1)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"qnhd/enums/LikeType"
 	ManagerLogType "qnhd/enums/MangerLogType"
 	"qnhd/enums/NoticeType"
+	"qnhd/enums/NotificationEventType"
 	"qnhd/enums/ReportType"
 	"qnhd/enums/TagPointType"
 	"qnhd/pkg/filter"
@@ -367,6 +368,10 @@ func AddFloor(maps map[string]interface{}) (uint64, error) {
 	if err := db.Create(&newFloor).Error; err != nil {
 		return 0, err
 	}
+	refImages(nil, []string{newFloor.ImageURL}, 1)
+	if err := addContentHash(ReportType.FLOOR, newFloor.Id, uid, newFloor.PostId, newFloor.Content); err != nil {
+		logging.Error("add content hash error: %v", err)
+	}
 	// 如果不是回复自己的帖子，通知帖子主人
 	var toNotifyIds []uint64
 
@@ -374,19 +379,20 @@ func AddFloor(maps map[string]interface{}) (uint64, error) {
 		toNotifyIds = append(toNotifyIds, post.Uid)
 	}
 
-	addUnreadFloor(newFloor.Id, toNotifyIds...)
+	addUnreadFloor(newFloor.Id, filterNotifyUids(toNotifyIds, NotificationEventType.FLOOR_ON_POST, NOTIFY_IN_APP, post.Id)...)
 
 	// 收藏的人的id
 	var favUserIds []uint64
-	db.Model(&LogPostFav{}).Select("uid").Where("post_id = ? AND uid != ?", post.Id, uid).Find(&favUserIds)
-	toNotifyIds = append(toNotifyIds, favUserIds...)
+	db.Model(&LogPostFav{}).Select("uid").Where("post_id = ? AND uid != ? AND uid != ?", post.Id, uid, post.Uid).Find(&favUserIds)
+
+	// 帖子主人和收藏的人按各自的偏好推送
+	toPushIds := filterNotifyUids(toNotifyIds, NotificationEventType.FLOOR_ON_POST, NOTIFY_PUSH, post.Id)
+	toPushIds = append(toPushIds, filterNotifyUids(favUserIds, NotificationEventType.FAV_POST_ACTIVITY, NOTIFY_PUSH, post.Id)...)
 	// 去重
-	toNotifyIds = util.SetUint64(toNotifyIds)
+	toPushIds = util.SetUint64(toPushIds)
 
-	// 添加未读记录
 	// 发送通知
-	var numbers []string
-	if err := db.Model(&User{}).Select("number").Where("id IN (?)", toNotifyIds).Find(&numbers).Error; err == nil {
+	if numbers := getNumbersByUids(toPushIds); len(numbers) > 0 {
 		twtservice.NotifyPost(post.Title, numbers...)
 	}
 
@@ -441,6 +447,10 @@ func ReplyFloor(maps map[string]interface{}) (uint64, error) {
 	if err := db.Create(&newFloor).Error; err != nil {
 		return 0, err
 	}
+	refImages(nil, []string{newFloor.ImageURL}, 1)
+	if err := addContentHash(ReportType.FLOOR, newFloor.Id, uid, newFloor.PostId, newFloor.Content); err != nil {
+		logging.Error("add content hash error: %v", err)
+	}
 
 	var toNotifyPostIds []uint64
 	var toNotifyFloorIds []uint64
@@ -451,33 +461,37 @@ func ReplyFloor(maps map[string]interface{}) (uint64, error) {
 	// 如果回复的楼层不是子楼层，通知回复的楼层的主人，这里开始避免重复
 	if toFloor.Uid != uid && toFloor.Uid != post.Uid {
 		toNotifyFloorIds = append(toNotifyFloorIds, toFloor.Uid)
-		user, _ := GetUser(map[string]interface{}{"id": toFloor.Uid})
-		twtservice.NotifyFloor(toFloor.Content, user.Number)
+		if len(filterNotifyUids([]uint64{toFloor.Uid}, NotificationEventType.REPLY_TO_FLOOR, NOTIFY_PUSH, post.Id)) > 0 {
+			user, _ := GetUser(map[string]interface{}{"id": toFloor.Uid})
+			twtservice.NotifyFloor(toFloor.Content, user.Number)
+		}
 	}
 	// 如果回复的帖子是子楼层，通知层主
 	if toFloor.SubTo != 0 {
 		subToFloor, _ := GetFloor(util.AsStrU(newFloor.SubTo))
 		if subToFloor.Uid != uid && subToFloor.Uid != toFloor.Uid && subToFloor.Uid != post.Uid {
 			toNotifyFloorIds = append(toNotifyFloorIds, subToFloor.Uid)
-			user, _ := GetUser(map[string]interface{}{"id": subToFloor.Uid})
-			twtservice.NotifyFloor(subToFloor.Content, user.Number)
+			if len(filterNotifyUids([]uint64{subToFloor.Uid}, NotificationEventType.REPLY_TO_FLOOR, NOTIFY_PUSH, post.Id)) > 0 {
+				user, _ := GetUser(map[string]interface{}{"id": subToFloor.Uid})
+				twtservice.NotifyFloor(subToFloor.Content, user.Number)
+			}
 		}
 	}
 
-	toNotifyFloorIds = append(toNotifyFloorIds, toNotifyPostIds...)
+	// 添加未读记录
+	toNotifyFloorIds = filterNotifyUids(toNotifyFloorIds, NotificationEventType.REPLY_TO_FLOOR, NOTIFY_IN_APP, post.Id)
+	toNotifyFloorIds = append(toNotifyFloorIds, filterNotifyUids(toNotifyPostIds, NotificationEventType.FLOOR_ON_POST, NOTIFY_IN_APP, post.Id)...)
 	addUnreadFloor(newFloor.Id, toNotifyFloorIds...)
 
 	// 收藏的人的id
 	var favUserIds []uint64
-	db.Model(&LogPostFav{}).Select("uid").Where("post_id = ? AND uid != ?", post.Id, uid).Find(&favUserIds)
+	db.Model(&LogPostFav{}).Select("uid").Where("post_id = ? AND uid != ? AND uid != ?", post.Id, uid, post.Uid).Find(&favUserIds)
 
-	// 添加未读记录
-
-	// 发送通知
-	toNotifyPostIds = append(toNotifyPostIds, favUserIds...)
+	// 帖子主人和收藏的人按各自的偏好推送
+	toPushIds := filterNotifyUids(toNotifyPostIds, NotificationEventType.FLOOR_ON_POST, NOTIFY_PUSH, post.Id)
+	toPushIds = append(toPushIds, filterNotifyUids(favUserIds, NotificationEventType.FAV_POST_ACTIVITY, NOTIFY_PUSH, post.Id)...)
 	// 发送通知
-	var numbers []string
-	if err := db.Model(&User{}).Select("number").Where("id IN (?)", toNotifyPostIds).Find(&numbers).Error; err == nil {
+	if numbers := getNumbersByUids(util.SetUint64(toPushIds)); len(numbers) > 0 {
 		twtservice.NotifyPost(post.Title, numbers...)
 	}
 
@@ -737,6 +751,7 @@ func LikeFloor(floorId string, uid string) (uint64, error) {
 
 	updatePostTime(floor.PostId)
 	addUnreadLike(floor.Uid, LikeType.FLOOR, floor.Id)
+	addLikeMilestone(floor.Uid, LikeType.FLOOR, floor.Id, floor.LikeCount)
 	UndisFloor(floorId, uid)
 	addTagLogInPost(floor.PostId, TagPointType.LIKE_FLOOR)
 	return floor.LikeCount, nil
@@ -1,14 +1,182 @@
 package models
 
+import (
+	"fmt"
+	"math"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/setting"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 浏览记录的每日计数
+type LogVisitDaily struct {
+	PostId uint64 `json:"post_id"`
+	Date   string `json:"date"`
+	Count  int64  `json:"count"`
+}
+
+// 清理结果
+type RetentionResult struct {
+	Table  string `json:"table"`
+	Policy string `json:"policy"`
+	Rows   int64  `json:"rows"`
+}
+
+// 按保留天数删除的表
+type retentionPolicy struct {
+	table string
+	days  int
+	// 过期条件，参数为截止时间
+	cond string
+}
+
+func retentionPolicies() []retentionPolicy {
+	r := setting.RetentionSetting
+	return []retentionPolicy{
+		{"qnhd.log_unread_floor", r.ReadFloorDays, "(is_read = true OR deleted_at IS NOT NULL) AND created_at < ?"},
+		{"qnhd.log_unread_post_reply", r.ReadReplyDays, "is_read = true AND created_at < ?"},
+		{"qnhd.log_unread_like", r.ReadLikeDays, "is_read = true AND COALESCE(updated_at, created_at) < ?"},
+		{"qnhd.log_unread_notice", r.ReadNoticeDays, "is_read = true AND pub_at < ?"},
+		{"qnhd.log_tag", tagLogDays(), "created_at < ?"},
+		{"qnhd.message_event", r.MessageEventDays, "created_at < ?"},
+	}
+}
+
+func daysAgo(days int) time.Time {
+	return time.Now().AddDate(0, 0, -days)
+}
+
+// 分批删除，每批一个事务，避免长时间锁表
+func purgeInBatches(table, cond string, before time.Time) (int64, error) {
+	var total int64
+	batch := setting.RetentionSetting.BatchSize
+	sql := fmt.Sprintf("DELETE FROM %s WHERE ctid IN (SELECT ctid FROM %s WHERE %s LIMIT ?)", table, table, cond)
+	for {
+		res := db.Exec(sql, before, batch)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+		if res.RowsAffected < int64(batch) {
+			return total, nil
+		}
+	}
+}
+
+// 按天把过期浏览记录聚合为每日计数
+func aggregateVisitHistory(before time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		var cnt int64
+		err := db.Model(&LogVisitHistory{}).Where("created_at < ?", before).Count(&cnt).Error
+		return cnt, err
+	}
+	var total int64
+	for {
+		var first LogVisitHistory
+		if err := db.Where("created_at < ?", before).Order("created_at").Limit(1).Find(&first).Error; err != nil {
+			return total, err
+		}
+		if first.PostId == 0 {
+			return total, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, first.CreatedAt)
+		if err != nil {
+			return total, err
+		}
+		from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		to := from.AddDate(0, 0, 1)
+		if to.After(before) {
+			to = before
+		}
+		// 一天为一批
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var counts []LogVisitDaily
+			if err := tx.Model(&LogVisitHistory{}).
+				Select("post_id, ? as date, COUNT(*) as count", from.Format("2006-01-02")).
+				Where("created_at >= ? AND created_at < ?", from, to).
+				Group("post_id").Find(&counts).Error; err != nil {
+				return err
+			}
+			var news []LogVisitDaily
+			for _, c := range counts {
+				res := tx.Model(&LogVisitDaily{}).Where("post_id = ? AND date = ?", c.PostId, c.Date).
+					Update("count", gorm.Expr("count + ?", c.Count))
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected == 0 {
+					news = append(news, c)
+				}
+			}
+			insertCount := 250
+			for i := 0; i < int(math.Ceil(float64(len(news))/float64(insertCount))); i++ {
+				min := (i + 1) * insertCount
+				if len(news) < min {
+					min = len(news)
+				}
+				if err := tx.Create(news[i*insertCount : min]).Error; err != nil {
+					return err
+				}
+			}
+			res := tx.Where("created_at >= ? AND created_at < ?", from, to).Delete(&LogVisitHistory{})
+			total += res.RowsAffected
+			return res.Error
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// 执行保留策略，dryRun时只统计将被清理的行数
+func FlushRetention(dryRun bool) ([]RetentionResult, error) {
+	var ret = []RetentionResult{}
+	for _, p := range retentionPolicies() {
+		if p.days <= 0 {
+			continue
+		}
+		before := daysAgo(p.days)
+		r := RetentionResult{Table: p.table, Policy: fmt.Sprintf("delete %s, %d days", p.cond, p.days)}
+		var err error
+		if dryRun {
+			err = db.Table(p.table).Where(p.cond, before).Count(&r.Rows).Error
+		} else {
+			r.Rows, err = purgeInBatches(p.table, p.cond, before)
+		}
+		ret = append(ret, r)
+		if err != nil {
+			return ret, err
+		}
+	}
+	if days := setting.RetentionSetting.VisitHistoryDays; days > 0 {
+		r := RetentionResult{Table: "qnhd.log_visit_history", Policy: fmt.Sprintf("aggregate into daily counts, %d days", days)}
+		var err error
+		r.Rows, err = aggregateVisitHistory(daysAgo(days), dryRun)
+		ret = append(ret, r)
+		if err != nil {
+			return ret, err
+		}
+	}
+	if !dryRun {
+		for _, r := range ret {
+			logging.Info("retention %s: %d rows", r.Table, r.Rows)
+		}
+	}
+	return ret, nil
+}
+
+// tag记录至少保留热度计算的天数
+func tagLogDays() int {
+	days := setting.RetentionSetting.TagLogDays
+	if w := tagHotConfig().WindowDays; w > days {
+		days = w
+	}
+	return days
+}
+
 // 删除记录
 func FlushOldTagLog() error {
-	return db.Where("created_at <= CURRENT_TIMESTAMP + '-2 day'").Delete(&LogTag{}).Error
+	return db.Where("created_at <= ?", daysAgo(tagLogDays())).Delete(&LogTag{}).Error
 }
-
-// 清理已读楼层
-// func FlushOldReadFloor() error {
-// 	return db.Where()
-// }
-// 清理已读回复
-// 清理已读点赞
-// 清理已读通知
@@ -2,20 +2,83 @@ package models
 
 import (
 	"qnhd/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// 浏览日志，用于统计
 type LogVisitHistory struct {
 	Uid       uint64 `json:"uid"`
 	PostId    uint64 `json:"post_id"`
 	CreatedAt string `json:"created_at" gorm:"default:null;"`
 }
 
+// 用户的浏览记录，每个帖子只保留最后一次浏览
+type UserVisitHistory struct {
+	Uid       uint64 `json:"uid"`
+	PostId    uint64 `json:"post_id"`
+	VisitedAt string `json:"visited_at" gorm:"default:null;"`
+}
+
 func AddVisitHistory(uid string, postId string) error {
 
 	var ps = LogVisitHistory{Uid: util.AsUint(uid), PostId: util.AsUint(postId)}
 	if err := db.Select("post_id", "uid").Create(&ps).Error; err != nil {
 		return err
 	}
+	bufferVisit(ps.Uid, ps.PostId)
+
+	// 关闭了浏览记录的用户只计入统计
+	var user User
+	if err := db.Select("history_disabled").Where("id = ?", uid).Find(&user).Error; err != nil {
+		return err
+	}
+	if user.HistoryDisabled {
+		return nil
+	}
+	var h UserVisitHistory
+	return db.Where(UserVisitHistory{Uid: ps.Uid, PostId: ps.PostId}).
+		Assign(map[string]interface{}{"visited_at": gorm.Expr("CURRENT_TIMESTAMP")}).
+		FirstOrCreate(&h).Error
+}
+
+// 获取浏览记录中的帖子id，按最后浏览时间排序
+func getHistoryPostIds(c *gin.Context, uid string) ([]uint64, error) {
+	var ids []uint64
+	err := db.Model(&UserVisitHistory{}).Select("post_id").Where("uid = ?", uid).
+		Order("visited_at DESC").Scopes(util.Paginate(c)).Find(&ids).Error
+	return ids, err
+}
+
+// 删除一条浏览记录
+func DeleteVisitHistory(uid, postId uint64) error {
+	return db.Where("uid = ? AND post_id = ?", uid, postId).Delete(&UserVisitHistory{}).Error
+}
+
+// 清空浏览记录
+func ClearVisitHistory(uid uint64) error {
+	return db.Where("uid = ?", uid).Delete(&UserVisitHistory{}).Error
+}
+
+// 开关浏览记录，关闭时清空已有的记录
+func EditUserHistoryDisabled(uid uint64, disabled bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", uid).Update("history_disabled", disabled).Error; err != nil {
+			return err
+		}
+		if disabled {
+			return tx.Where("uid = ?", uid).Delete(&UserVisitHistory{}).Error
+		}
+		return nil
+	})
+}
 
-	return nil
+// 从浏览日志生成浏览记录，只处理还没有记录的部分
+func FlushUserVisitHistory() error {
+	return db.Exec(`INSERT INTO qnhd.user_visit_history (uid, post_id, visited_at)
+	SELECT l.uid, l.post_id, MAX(l.created_at) FROM qnhd.log_visit_history AS l
+	WHERE NOT EXISTS (SELECT 1 FROM qnhd.user_visit_history AS h WHERE h.uid = l.uid AND h.post_id = l.post_id)
+	AND l.uid NOT IN (SELECT id FROM qnhd.user WHERE history_disabled = true)
+	GROUP BY l.uid, l.post_id`).Error
 }
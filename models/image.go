@@ -0,0 +1,222 @@
+package models
+
+import (
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/enums/NoticeType"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/upload"
+	"qnhd/pkg/util"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 上传的图片，按内容hash去重
+type Image struct {
+	Hash      string `json:"-" gorm:"primaryKey"`
+	Uid       uint64 `json:"-"`
+	Url       string `json:"url"`
+	ThumbUrl  string `json:"thumb_url"`
+	MediumUrl string `json:"medium_url"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Size      int    `json:"size"`
+	// 被帖子、回复和楼层引用的次数
+	RefCount int64 `json:"-" gorm:"default:0"`
+	// 引用数变为0的时间，超过宽限期后删除文件
+	UnreferencedAt string `json:"-" gorm:"default:null;"`
+	// 被管理员下架，不能再次上传
+	TakenDown bool   `json:"-" gorm:"default:false"`
+	CreatedAt string `json:"-" gorm:"autoCreateTime;default:null;"`
+}
+
+func GetImageByHash(hash string) (Image, error) {
+	var img Image
+	err := db.Where("hash = ?", hash).Find(&img).Error
+	return img, err
+}
+
+// 并发上传相同内容时以先写入的记录为准
+func AddImage(img *Image) error {
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(img).Error; err != nil {
+		return err
+	}
+	return db.Where("hash = ?", img.Hash).First(img).Error
+}
+
+// 重新上传未被引用的图片时重置宽限期，避免在引用前被清理
+func TouchImage(hash string) error {
+	return db.Model(&Image{}).Where("hash = ? AND ref_count = 0", hash).
+		Update("unreferenced_at", gorm.Expr("CURRENT_TIMESTAMP")).Error
+}
+
+// 只接受本站上传并且没有被下架的图片地址
+func ValidImageUrls(urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	var imgs []Image
+	if err := db.Select("url", "taken_down").Where("url IN (?)", urls).Find(&imgs).Error; err != nil {
+		return err
+	}
+	for _, img := range imgs {
+		if img.TakenDown {
+			return fmt.Errorf("该图片已被下架")
+		}
+	}
+	// 同一张图片可以出现多次
+	set := map[string]bool{}
+	for _, u := range urls {
+		set[u] = true
+	}
+	if len(imgs) != len(set) {
+		return fmt.Errorf("图片地址无效，请先上传图片")
+	}
+	return nil
+}
+
+// 修改图片的引用数
+func refImages(tx *gorm.DB, urls []string, delta int) error {
+	if tx == nil {
+		tx = db
+	}
+	for _, url := range urls {
+		if url == "" {
+			continue
+		}
+		if err := tx.Model(&Image{}).Where("url = ?", url).Updates(map[string]interface{}{
+			"ref_count":       gorm.Expr("GREATEST(ref_count + ?, 0)", delta),
+			"unreferenced_at": gorm.Expr("CASE WHEN ref_count + ? <= 0 THEN CURRENT_TIMESTAMP ELSE NULL END", delta),
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按帖子、回复、楼层和待审核内容重新统计引用数，各表只扫描一次
+func FlushImageRefCounts() error {
+	return db.Exec(`UPDATE qnhd.image AS i SET ref_count = c.cnt,
+		unreferenced_at = CASE WHEN c.cnt = 0 THEN COALESCE(i.unreferenced_at, CURRENT_TIMESTAMP) ELSE NULL END
+	FROM (SELECT img.hash, COALESCE(r.cnt, 0) AS cnt FROM qnhd.image AS img
+		LEFT JOIN (SELECT image_url, COUNT(*) AS cnt FROM (
+			SELECT image_url FROM qnhd.post_image
+			UNION ALL SELECT image_url FROM qnhd.post_reply_image
+			UNION ALL SELECT image_url FROM qnhd.floor WHERE image_url <> ''
+			UNION ALL SELECT jsonb_array_elements_text(data::jsonb -> 'image_urls') FROM qnhd.held_content
+				WHERE status = 0 AND jsonb_typeof(data::jsonb -> 'image_urls') = 'array'
+		) AS refs GROUP BY image_url) AS r ON r.image_url = img.url
+		WHERE img.taken_down = false) AS c
+	WHERE i.hash = c.hash AND (i.ref_count <> c.cnt OR (c.cnt = 0 AND i.unreferenced_at IS NULL))`).Error
+}
+
+func removeImageFiles(img Image) {
+	for _, url := range []string{img.Url, img.ThumbUrl, img.MediumUrl} {
+		if err := upload.RemoveImage(url); err != nil {
+			logging.Error("remove image file error: %v", err)
+		}
+	}
+}
+
+// 删除超过宽限期仍未被引用的图片
+func FlushOrphanImages() (int, error) {
+	if err := FlushImageRefCounts(); err != nil {
+		return 0, err
+	}
+	before := time.Now().Add(-time.Duration(setting.RetentionSetting.OrphanImageHours) * time.Hour)
+	var imgs []Image
+	if err := db.Where("ref_count = 0 AND taken_down = false AND COALESCE(unreferenced_at, created_at) < ?", before).Find(&imgs).Error; err != nil {
+		return 0, err
+	}
+	for _, img := range imgs {
+		// 删除前再确认一次，避免刚被引用
+		res := db.Where("hash = ? AND ref_count = 0", img.Hash).Delete(&Image{})
+		if res.Error != nil {
+			return 0, res.Error
+		}
+		if res.RowsAffected > 0 {
+			removeImageFiles(img)
+		}
+	}
+	return len(imgs), nil
+}
+
+// 下架图片，从所有帖子、回复和楼层中移除并通知作者
+func TakeDownImage(uid string, url, reason string) error {
+	var img Image
+	if err := db.Where("url = ? OR thumb_url = ? OR medium_url = ?", url, url, url).First(&img).Error; err != nil {
+		return err
+	}
+	var (
+		postIds  []uint64
+		replyIds []uint64
+		floors   []Floor
+	)
+	if err := db.Model(&PostImage{}).Select("post_id").Where("image_url = ?", img.Url).Find(&postIds).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&PostReplyImage{}).Select("post_reply_id").Where("image_url = ?", img.Url).Find(&replyIds).Error; err != nil {
+		return err
+	}
+	if err := db.Unscoped().Where("image_url = ?", img.Url).Find(&floors).Error; err != nil {
+		return err
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_url = ?", img.Url).Delete(&PostImage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("image_url = ?", img.Url).Delete(&PostReplyImage{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&Floor{}).Where("image_url = ?", img.Url).Update("image_url", "").Error; err != nil {
+			return err
+		}
+		return tx.Model(&Image{}).Where("hash = ?", img.Hash).Updates(map[string]interface{}{
+			"ref_count":  0,
+			"taken_down": true,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+	removeImageFiles(img)
+	addManagerLogWithDetail(util.AsUint(uid), 0, ManagerLogType.IMAGE_TAKE_DOWN, fmt.Sprintf("url: %s, reason: %s", img.Url, reason))
+
+	// 通知作者，每个帖子只通知一次
+	type notified struct {
+		uid    uint64
+		postId uint64
+	}
+	var sent = map[notified]bool{}
+	notify := func(to, postId uint64) {
+		if sent[notified{to, postId}] {
+			return
+		}
+		sent[notified{to, postId}] = true
+		var post Post
+		db.Unscoped().Select("title").Where("id = ?", postId).Find(&post)
+		addNoticeWithTemplate(NoticeType.IMAGE_TAKEN_DOWN, []uint64{to}, []string{post.Title, reason})
+	}
+	if len(postIds) > 0 {
+		var posts []Post
+		db.Unscoped().Select("id", "uid").Where("id IN (?)", postIds).Find(&posts)
+		for _, p := range posts {
+			notify(p.Uid, p.Id)
+		}
+	}
+	if len(replyIds) > 0 {
+		// 回复只有帖子主人可以带图
+		var posts []Post
+		db.Unscoped().Select("id", "uid").Where("id IN (?)", db.Model(&PostReply{}).Select("post_id").Where("id IN (?)", replyIds)).Find(&posts)
+		for _, p := range posts {
+			notify(p.Uid, p.Id)
+		}
+	}
+	for _, f := range floors {
+		notify(f.Uid, f.PostId)
+	}
+	return nil
+}
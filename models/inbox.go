@@ -0,0 +1,297 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"qnhd/enums/LikeType"
+	"qnhd/pkg/util"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	INBOX_FLOOR     = "floor"
+	INBOX_REPLY     = "reply"
+	INBOX_LIKE      = "like"
+	INBOX_NOTICE    = "notice"
+	INBOX_BROADCAST = "broadcast"
+)
+
+// 消息中心的一条消息，按类型只有一个内容字段不为空
+type InboxItem struct {
+	// 形如 floor:1 like:0:1 broadcast:1，用于批量已读和删除
+	ItemId    string    `json:"item_id"`
+	Type      string    `json:"type"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+
+	Floor  *UnreadFloorResponse  `json:"floor,omitempty"`
+	Reply  *UnreadReplyResponse  `json:"reply,omitempty"`
+	Like   *UnreadLikeResponse   `json:"like,omitempty"`
+	Notice *UnreadNoticeResponse `json:"notice,omitempty"`
+}
+
+// 排序键，按 (created_at, kind, sub, id) 倒序
+type inboxRow struct {
+	Kind      string    `json:"k"`
+	Sub       int       `json:"s"`
+	Id        uint64    `json:"i"`
+	IsRead    bool      `json:"-"`
+	CreatedAt time.Time `json:"t"`
+}
+
+func (a inboxRow) less(b inboxRow) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	if a.Sub != b.Sub {
+		return a.Sub < b.Sub
+	}
+	return a.Id < b.Id
+}
+
+func (a inboxRow) itemId() string {
+	if a.Kind == INBOX_LIKE {
+		return fmt.Sprintf("%s:%d:%d", a.Kind, a.Sub, a.Id)
+	}
+	return fmt.Sprintf("%s:%d", a.Kind, a.Id)
+}
+
+func (a inboxRow) cursor() string {
+	b, _ := json.Marshal(a)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func ParseInboxCursor(cursor string) (inboxRow, error) {
+	var row inboxRow
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return row, fmt.Errorf("cursor格式错误")
+	}
+	if err := json.Unmarshal(b, &row); err != nil {
+		return row, fmt.Errorf("cursor格式错误")
+	}
+	return row, nil
+}
+
+// 解析消息id
+func ParseInboxItemId(itemId string) (inboxRow, error) {
+	var row inboxRow
+	parts := strings.Split(itemId, ":")
+	switch {
+	case len(parts) == 2 && parts[0] != INBOX_LIKE:
+		row.Kind, row.Id = parts[0], util.AsUint(parts[1])
+	case len(parts) == 3 && parts[0] == INBOX_LIKE:
+		row.Kind, row.Sub, row.Id = parts[0], util.AsInt(parts[1]), util.AsUint(parts[2])
+	default:
+		return row, fmt.Errorf("消息id格式错误: %s", itemId)
+	}
+	switch row.Kind {
+	case INBOX_FLOOR, INBOX_REPLY, INBOX_LIKE, INBOX_NOTICE, INBOX_BROADCAST:
+	default:
+		return row, fmt.Errorf("消息类型错误: %s", itemId)
+	}
+	if row.Id == 0 {
+		return row, fmt.Errorf("消息id格式错误: %s", itemId)
+	}
+	return row, nil
+}
+
+const inboxSql = `SELECT * FROM (
+	SELECT 'floor' AS kind, 0 AS sub, floor_id AS id, is_read, created_at FROM qnhd.log_unread_floor WHERE uid = @uid AND deleted_at IS NULL
+	UNION ALL
+	SELECT 'reply', 0, reply_id, is_read, created_at FROM qnhd.log_unread_post_reply WHERE uid = @uid
+	UNION ALL
+	SELECT 'like', type, id, is_read, COALESCE(updated_at, created_at) FROM qnhd.log_unread_like WHERE uid = @uid
+	UNION ALL
+	SELECT 'notice', 0, id, is_read, pub_at FROM qnhd.log_unread_notice WHERE uid = @uid AND pub_at < CURRENT_TIMESTAMP
+) AS i`
+
+// 获取消息中心，cursor为空时从最新开始
+func GetInbox(c *gin.Context, uid uint64, cursor string, limit int) ([]InboxItem, string, error) {
+	var (
+		rows []inboxRow
+		ret  = []InboxItem{}
+		cur  inboxRow
+		err  error
+	)
+	args := map[string]interface{}{"uid": uid, "limit": limit}
+	sql := inboxSql
+	if cursor != "" {
+		if cur, err = ParseInboxCursor(cursor); err != nil {
+			return ret, "", err
+		}
+		sql += " WHERE (created_at, kind, sub, id) < (@t, @kind, @sub, @id)"
+		args["t"], args["kind"], args["sub"], args["id"] = cur.CreatedAt, cur.Kind, cur.Sub, cur.Id
+	}
+	sql += " ORDER BY created_at DESC, kind DESC, sub DESC, id DESC LIMIT @limit"
+	if err = db.Raw(sql, args).Scan(&rows).Error; err != nil {
+		return ret, "", err
+	}
+
+	// 广播通知在读取时合并
+	broadcasts, err := getBroadcastNotices(uid)
+	if err != nil {
+		return ret, "", err
+	}
+	broadcastMap := map[uint64]broadcastResult{}
+	for _, b := range broadcasts {
+		row := inboxRow{Kind: INBOX_BROADCAST, Id: b.Id, IsRead: b.IsRead}
+		t := b.CreatedAt
+		if b.PubAt != "" {
+			t = b.PubAt
+		}
+		if row.CreatedAt, err = time.Parse(time.RFC3339Nano, t); err != nil {
+			continue
+		}
+		if cursor != "" && !row.less(cur) {
+			continue
+		}
+		broadcastMap[b.Id] = b
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[j].less(rows[i])
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	var next string
+	if len(rows) == limit {
+		next = rows[len(rows)-1].cursor()
+	}
+	for _, row := range rows {
+		item := InboxItem{ItemId: row.itemId(), Type: row.Kind, IsRead: row.IsRead, CreatedAt: row.CreatedAt}
+		switch row.Kind {
+		case INBOX_FLOOR:
+			var f Floor
+			if err := db.Where("id = ?", row.Id).First(&f).Error; err != nil {
+				continue
+			}
+			r, err := geneUnreadFloorResponse(f, row.IsRead)
+			if err != nil {
+				continue
+			}
+			item.Floor = &r
+		case INBOX_REPLY:
+			var pr PostReply
+			if err := db.Where("id = ?", row.Id).First(&pr).Error; err != nil {
+				continue
+			}
+			r, err := geneUnreadReplyResponse(pr, row.IsRead)
+			if err != nil {
+				continue
+			}
+			item.Reply = &r
+		case INBOX_LIKE:
+			var log LogUnreadLike
+			if err := db.Where("uid = ? AND type = ? AND id = ?", uid, row.Sub, row.Id).Find(&log).Error; err != nil || log.Uid == 0 {
+				continue
+			}
+			r, ok := geneUnreadLikeResponse(log)
+			if !ok {
+				continue
+			}
+			item.Like = &r
+		case INBOX_NOTICE:
+			var logs []noticeResult
+			if err := findNoticeResults(db.Model(&LogUnreadNotice{}).Where("id = ?", row.Id), &logs); err != nil || len(logs) == 0 {
+				continue
+			}
+			r := geneUnreadNoticeResponses(c, logs)[0]
+			item.Notice = &r
+		case INBOX_BROADCAST:
+			r := geneBroadcastNoticeResponse(broadcastMap[row.Id])
+			item.Notice = &r
+		}
+		ret = append(ret, item)
+	}
+	return ret, next, nil
+}
+
+// 按类型分组
+func groupInboxItems(itemIds []string) (map[string][]inboxRow, error) {
+	var groups = map[string][]inboxRow{}
+	for _, itemId := range itemIds {
+		row, err := ParseInboxItemId(itemId)
+		if err != nil {
+			return groups, err
+		}
+		groups[row.Kind] = append(groups[row.Kind], row)
+	}
+	return groups, nil
+}
+
+func inboxIds(rows []inboxRow) []uint64 {
+	var ids []uint64
+	for _, r := range rows {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+// 批量已读
+func ReadInboxItems(uid uint64, itemIds []string) error {
+	groups, err := groupInboxItems(itemIds)
+	if err != nil {
+		return err
+	}
+	if rows := groups[INBOX_FLOOR]; len(rows) > 0 {
+		if err := db.Model(&LogUnreadFloor{}).Where("uid = ? AND floor_id IN (?)", uid, inboxIds(rows)).Update("is_read", true).Error; err != nil {
+			return err
+		}
+	}
+	if rows := groups[INBOX_REPLY]; len(rows) > 0 {
+		if err := db.Model(&LogUnreadPostReply{}).Where("uid = ? AND reply_id IN (?)", uid, inboxIds(rows)).Update("is_read", true).Error; err != nil {
+			return err
+		}
+	}
+	for _, row := range groups[INBOX_LIKE] {
+		if err := ReadLike(uid, LikeType.Enum(row.Sub), row.Id); err != nil {
+			return err
+		}
+	}
+	if rows := groups[INBOX_NOTICE]; len(rows) > 0 {
+		if err := db.Model(&LogUnreadNotice{}).Where("uid = ? AND id IN (?)", uid, inboxIds(rows)).Update("is_read", true).Error; err != nil {
+			return err
+		}
+	}
+	return markBroadcastNotices(uid, inboxIds(groups[INBOX_BROADCAST]), map[string]interface{}{"is_read": true})
+}
+
+// 批量删除
+func DeleteInboxItems(uid uint64, itemIds []string) error {
+	groups, err := groupInboxItems(itemIds)
+	if err != nil {
+		return err
+	}
+	if rows := groups[INBOX_FLOOR]; len(rows) > 0 {
+		if err := db.Where("uid = ? AND floor_id IN (?)", uid, inboxIds(rows)).Delete(&LogUnreadFloor{}).Error; err != nil {
+			return err
+		}
+	}
+	if rows := groups[INBOX_REPLY]; len(rows) > 0 {
+		if err := db.Where("uid = ? AND reply_id IN (?)", uid, inboxIds(rows)).Delete(&LogUnreadPostReply{}).Error; err != nil {
+			return err
+		}
+	}
+	for _, row := range groups[INBOX_LIKE] {
+		if err := db.Where("uid = ? AND type = ? AND id = ?", uid, row.Sub, row.Id).Delete(&LogUnreadLike{}).Error; err != nil {
+			return err
+		}
+	}
+	if rows := groups[INBOX_NOTICE]; len(rows) > 0 {
+		if err := db.Where("uid = ? AND id IN (?)", uid, inboxIds(rows)).Delete(&LogUnreadNotice{}).Error; err != nil {
+			return err
+		}
+	}
+	return deleteBroadcastNotices(uid, inboxIds(groups[INBOX_BROADCAST]))
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"qnhd/pkg/logging"
+	"strings"
+)
+
+// 消息事件的NOTIFY频道
+const MESSAGE_EVENT_CHANNEL = "qnhd_message"
+
+const (
+	MESSAGE_EVENT_FLOOR  = "floor"
+	MESSAGE_EVENT_REPLY  = "reply"
+	MESSAGE_EVENT_LIKE   = "like"
+	MESSAGE_EVENT_NOTICE = "notice"
+)
+
+// 断线重连时最多补发的事件数
+const MESSAGE_EVENT_RESUME_LIMIT = 200
+
+// 实时消息事件，uid为0表示所有用户
+type MessageEvent struct {
+	Id     uint64 `gorm:"primaryKey;autoIncrement;" json:"id"`
+	Uid    uint64 `json:"uid"`
+	Type   string `json:"type"`
+	ItemId uint64 `json:"item_id"`
+	// 指定受众的广播通知，只发给通知的接收者
+	Targeted  bool   `json:"targeted,omitempty" gorm:"default:false"`
+	CreatedAt string `json:"created_at" gorm:"default:null;"`
+}
+
+// 记录事件并通知所有实例
+func publishMessageEvent(typ string, itemId uint64, uids ...uint64) {
+	var events []MessageEvent
+	for _, u := range uids {
+		events = append(events, MessageEvent{Uid: u, Type: typ, ItemId: itemId})
+	}
+	saveMessageEvents(events)
+}
+
+// 指定受众的广播通知只记录一个事件，接收者在分发和补发时从NoticeRecipient中查
+func publishTargetedNotice(noticeId uint64) {
+	saveMessageEvents([]MessageEvent{{Type: MESSAGE_EVENT_NOTICE, ItemId: noticeId, Targeted: true}})
+}
+
+func saveMessageEvents(events []MessageEvent) {
+	insertCount := 250
+	for i := 0; i < int(math.Ceil(float64(len(events))/float64(insertCount))); i++ {
+		min := (i + 1) * insertCount
+		if len(events) < min {
+			min = len(events)
+		}
+		batch := events[i*insertCount : min]
+		if err := db.Create(batch).Error; err != nil {
+			logging.Error("add message event error: %v", err)
+			return
+		}
+		// 每批的通知合并为一条语句，事件很小，不会超过payload 8000字节的限制
+		var (
+			calls []string
+			args  []interface{}
+		)
+		for _, ev := range batch {
+			payload, _ := json.Marshal(ev)
+			calls = append(calls, "pg_notify(?, ?)")
+			args = append(args, MESSAGE_EVENT_CHANNEL, string(payload))
+		}
+		if err := db.Exec("SELECT "+strings.Join(calls, ", "), args...).Error; err != nil {
+			logging.Error("notify message event error: %v", err)
+		}
+	}
+}
+
+// 在线用户中属于通知接收者的
+func FilterNoticeRecipients(noticeId uint64, uids []uint64) (map[uint64]bool, error) {
+	var list []uint64
+	ret := map[uint64]bool{}
+	if len(uids) == 0 {
+		return ret, nil
+	}
+	if err := db.Model(&NoticeRecipient{}).Where("notice_id = ? AND uid IN (?)", noticeId, uids).
+		Pluck("uid", &list).Error; err != nil {
+		return ret, err
+	}
+	for _, u := range list {
+		ret[u] = true
+	}
+	return ret, nil
+}
+
+// 获取某个事件之后的事件，用于断线续传
+func GetMessageEventsAfter(uid, lastId uint64) ([]MessageEvent, error) {
+	var events = []MessageEvent{}
+	recipients := db.Model(&NoticeRecipient{}).Select("notice_id").Where("uid = ?", uid)
+	err := db.Where("id > ? AND (uid = ? OR (uid = 0 AND (targeted = false OR item_id IN (?))))", lastId, uid, recipients).
+		Order("id").Limit(MESSAGE_EVENT_RESUME_LIMIT).Find(&events).Error
+	return events, err
+}
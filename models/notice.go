@@ -3,6 +3,8 @@ package models
 import (
 	"fmt"
 	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/enums/NoticeType"
+	"qnhd/enums/PermissionType"
 	"qnhd/pkg/util"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +17,13 @@ type Notice struct {
 	Title   string `json:"title"`
 	Content string `json:"content"`
 	Symbol  string `json:"symbol"`
+	// 受众条件，为空表示全体用户
+	Audience string `json:"audience" gorm:"default:''"`
+	// 广播通知在读取时合并，不逐个写入用户记录
+	Broadcast bool   `json:"-" gorm:"default:false"`
+	PubAt     string `json:"pub_at" gorm:"default:null"`
+	// 模板语言
+	Locale string `json:"locale" gorm:"default:zh"`
 }
 
 const NOTICE_DEPARTMENT = "department_manager"
@@ -34,18 +43,18 @@ func GetNotices(c *gin.Context, departmentOnly bool) ([]Notice, error) {
 // 向所有用户添加通知
 func AddNoticeToAllUsers(uid string, data map[string]interface{}) error {
 	data["symbol"] = "public"
-	var user User
-	db.Where("id = ?", uid).Find(&user)
-	if user.IsSchAdmin {
+	if !HasPermission(uid, PermissionType.NOTICE_BROADCAST) {
 		data["symbol"] = "department_manager"
+	} else {
+		data["broadcast"] = true
 	}
 	id, err := AddNoticeTemplate(data)
 	if err != nil {
 		return err
 	}
 
-	// 对所有用户通知
-	if err := addUnreadNoticeToAllUser(id, data["pub_at"].(string), user.IsSchAdmin); err != nil {
+	// 对所有用户推送
+	if err := pushNoticeToAudience(id, NoticeAudience{}); err != nil {
 		return err
 	}
 
@@ -53,29 +62,87 @@ func AddNoticeToAllUsers(uid string, data map[string]interface{}) error {
 	return nil
 }
 
+// 向指定受众添加通知
+func AddNoticeToAudience(uid string, data map[string]interface{}, audience NoticeAudience) error {
+	if audience.IsEmpty() {
+		return AddNoticeToAllUsers(uid, data)
+	}
+	if !HasPermission(uid, PermissionType.NOTICE_BROADCAST) {
+		return fmt.Errorf("部门管理员不能指定通知受众")
+	}
+	data["symbol"] = "public"
+	data["audience"] = audience.String()
+	data["broadcast"] = true
+	var id uint64
+	err := db.Transaction(func(tx *gorm.DB) (err error) {
+		if id, err = addNoticeTemplate(tx, data); err != nil {
+			return err
+		}
+		return addNoticeRecipients(tx, id, audience)
+	})
+	if err != nil {
+		return err
+	}
+	if err := pushNoticeToAudience(id, audience); err != nil {
+		return err
+	}
+	addManagerLogWithDetail(util.AsUint(uid), id, ManagerLogType.NOTICE_NEW, fmt.Sprintf("audience: %s", audience.String()))
+	return nil
+}
+
 func AddNoticeTemplate(data map[string]interface{}) (uint64, error) {
+	return addNoticeTemplate(db, data)
+}
+
+func addNoticeTemplate(tx *gorm.DB, data map[string]interface{}) (uint64, error) {
 	var notice = Notice{
 		Sender:  data["sender"].(string),
 		Title:   data["title"].(string),
 		Content: data["content"].(string),
 		Symbol:  data["symbol"].(string),
+		Locale:  DEFAULT_LOCALE,
+	}
+	if locale, ok := data["locale"].(string); ok && locale != "" {
+		notice.Locale = locale
+	}
+	// 系统通知需要校验参数，且每种语言只能有一个
+	if _, ok := NoticeType.FromSymbol(notice.Symbol); ok {
+		if err := ValidNoticeTemplate(notice.Symbol, notice.Content); err != nil {
+			return 0, err
+		}
+		var exist Notice
+		if err := tx.Where("symbol = ?", notice.Symbol).Where(localeIs(notice.Locale)).Find(&exist).Error; err != nil {
+			return 0, err
+		}
+		if exist.Id > 0 {
+			return 0, fmt.Errorf("该语言的模板已存在")
+		}
+	}
+	if audience, ok := data["audience"].(string); ok {
+		notice.Audience = audience
+	}
+	if broadcast, ok := data["broadcast"].(bool); ok {
+		notice.Broadcast = broadcast
+	}
+	if pubAt, ok := data["pub_at"].(string); ok {
+		notice.PubAt = pubAt
 	}
 	// 创建模板
-	err := db.Create(&notice).Error
+	err := tx.Create(&notice).Error
 	return notice.Id, err
 }
 
 func EditNoticeTemplate(uid string, id uint64, data map[string]interface{}) error {
-	var (
-		notice Notice
-		user   User
-	)
+	var notice Notice
 	db.Where("id = ?", id).Find(&notice)
-	db.Where("id = ?", uid).Find(&user)
-	fmt.Println(user, notice)
-	if user.IsSchAdmin && notice.Symbol != NOTICE_DEPARTMENT {
+	if !HasPermission(uid, PermissionType.NOTICE_BROADCAST) && notice.Symbol != NOTICE_DEPARTMENT {
 		return fmt.Errorf("不能修改非部门公告")
 	}
+	if content := data["content"].(string); content != "" {
+		if err := ValidNoticeTemplate(notice.Symbol, content); err != nil {
+			return err
+		}
+	}
 	if err := db.Where("id = ?", id).Updates(&Notice{
 		Sender:  data["sender"].(string),
 		Title:   data["title"].(string),
@@ -88,20 +155,22 @@ func EditNoticeTemplate(uid string, id uint64, data map[string]interface{}) erro
 }
 
 func DeleteNoticeTemplate(uid string, id uint64) (uint64, error) {
-	var (
-		notice Notice
-		user   User
-	)
+	var notice Notice
 	db.Where("id = ?", id).Find(&notice)
-	db.Where("id = ?", uid).Find(&user)
-	if user.IsSchAdmin && notice.Symbol != NOTICE_DEPARTMENT {
+	if !HasPermission(uid, PermissionType.NOTICE_BROADCAST) && notice.Symbol != NOTICE_DEPARTMENT {
 		return 0, fmt.Errorf("不能删除非部门公告")
 	}
 	err := db.Transaction(func(tx *gorm.DB) error {
 		if err := db.Where("id = ?", id).Delete(&notice).Error; err != nil {
 			return err
 		}
-		return db.Where("notice_id = ?", id).Delete(&LogUnreadNotice{}).Error
+		if err := db.Where("notice_id = ?", id).Delete(&LogUnreadNotice{}).Error; err != nil {
+			return err
+		}
+		if err := db.Where("notice_id = ?", id).Delete(&LogBroadcastNotice{}).Error; err != nil {
+			return err
+		}
+		return db.Where("notice_id = ?", id).Delete(&NoticeRecipient{}).Error
 	})
 	addManagerLog(util.AsUint(uid), id, ManagerLogType.NOTICE_DELETE)
 	return notice.Id, err
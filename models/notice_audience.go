@@ -0,0 +1,108 @@
+package models
+
+import (
+	"encoding/json"
+	"qnhd/enums/PostCampusType"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 普通用户
+	AUDIENCE_ROLE_USER = "user"
+	// 管理员
+	AUDIENCE_ROLE_MANAGER = "manager"
+	// 全部
+	AUDIENCE_ROLE_ALL = "all"
+)
+
+// 通知受众，各条件之间取交集，为空的条件不做限制
+type NoticeAudience struct {
+	// 在某校区发过帖的用户
+	Campus []PostCampusType.Enum `json:"campus,omitempty"`
+	// 在某分区发过帖的用户
+	PostTypes []int `json:"post_types,omitempty"`
+	// 部门成员
+	DepartmentIds []uint64 `json:"department_ids,omitempty"`
+	// 指定用户id
+	Uids []uint64 `json:"uids,omitempty"`
+	// 指定学号
+	Numbers []string `json:"numbers,omitempty"`
+	// 用户身份，默认为普通用户
+	Role string `json:"role,omitempty"`
+	// 注册时间范围
+	RegisteredFrom string `json:"registered_from,omitempty"`
+	RegisteredTo   string `json:"registered_to,omitempty"`
+}
+
+// 是否为全体用户
+func (a *NoticeAudience) IsEmpty() bool {
+	return len(a.Campus) == 0 &&
+		len(a.PostTypes) == 0 &&
+		len(a.DepartmentIds) == 0 &&
+		len(a.Uids) == 0 &&
+		len(a.Numbers) == 0 &&
+		(a.Role == "" || a.Role == AUDIENCE_ROLE_USER) &&
+		a.RegisteredFrom == "" &&
+		a.RegisteredTo == ""
+}
+
+func (a *NoticeAudience) String() string {
+	if a.IsEmpty() {
+		return ""
+	}
+	b, _ := json.Marshal(a)
+	return string(b)
+}
+
+// 在user表上筛选受众
+func (a *NoticeAudience) scope(d *gorm.DB) *gorm.DB {
+	d = d.Where("active = true")
+	switch a.Role {
+	case AUDIENCE_ROLE_ALL:
+	case AUDIENCE_ROLE_MANAGER:
+		d = d.Where("is_user = false")
+	default:
+		d = d.Where("is_user = true")
+	}
+	if len(a.Campus) > 0 || len(a.PostTypes) > 0 {
+		posts := db.Model(&Post{}).Select("uid")
+		if len(a.Campus) > 0 {
+			posts = posts.Where("campus IN (?)", a.Campus)
+		}
+		if len(a.PostTypes) > 0 {
+			posts = posts.Where("type IN (?)", a.PostTypes)
+		}
+		d = d.Where("id IN (?)", posts)
+	}
+	if len(a.DepartmentIds) > 0 {
+		d = d.Where("id IN (?)", db.Model(&UserDepartment{}).Select("uid").Where("department_id IN (?)", a.DepartmentIds))
+	}
+	if len(a.Uids) > 0 {
+		d = d.Where("id IN (?)", a.Uids)
+	}
+	if len(a.Numbers) > 0 {
+		d = d.Where("number IN (?)", a.Numbers)
+	}
+	if a.RegisteredFrom != "" {
+		d = d.Where("created_at >= ?", a.RegisteredFrom)
+	}
+	if a.RegisteredTo != "" {
+		d = d.Where("created_at < ?", a.RegisteredTo)
+	}
+	return d
+}
+
+// 获取受众用户
+func getAudienceUsers(a NoticeAudience) ([]userResult, error) {
+	var users []userResult
+	err := db.Model(&User{}).Select("id", "number").Scopes(a.scope).Order("id").Find(&users).Error
+	return users, err
+}
+
+// 预览受众人数
+func CountNoticeAudience(a NoticeAudience) (int64, error) {
+	var cnt int64
+	err := db.Model(&User{}).Scopes(a.scope).Count(&cnt).Error
+	return cnt, err
+}
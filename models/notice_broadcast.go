@@ -0,0 +1,117 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"qnhd/pkg/logging"
+
+	"gorm.io/gorm"
+)
+
+// 广播通知只存一份，用户已读或删除时才写入记录
+type LogBroadcastNotice struct {
+	Uid       uint64 `json:"uid"`
+	NoticeId  uint64 `json:"notice_id"`
+	IsRead    bool   `json:"is_read" gorm:"default:false"`
+	IsDeleted bool   `json:"is_deleted" gorm:"default:false"`
+	CreatedAt string `json:"created_at" gorm:"default:null;"`
+}
+
+// 指定受众的广播通知在发送时确定接收者
+type NoticeRecipient struct {
+	NoticeId uint64 `json:"notice_id"`
+	Uid      uint64 `json:"uid"`
+}
+
+type broadcastResult struct {
+	Notice
+	IsRead bool
+}
+
+// 记录受众内的用户，之后受众条件变化不影响已发送的通知
+func addNoticeRecipients(tx *gorm.DB, noticeId uint64, audience NoticeAudience) error {
+	users := tx.Model(&User{}).Select(fmt.Sprintf("%d, id", noticeId)).Scopes(audience.scope)
+	return tx.Exec("INSERT INTO qnhd.notice_recipient (notice_id, uid) (?)", users).Error
+}
+
+// 为还没有接收者记录的指定受众广播补充记录
+func SetupNoticeRecipients() error {
+	var notices []Notice
+	if err := db.Where("broadcast = true AND audience <> ''").
+		Where("NOT EXISTS (SELECT 1 FROM qnhd.notice_recipient AS nr WHERE nr.notice_id = qnhd.notice.id)").
+		Find(&notices).Error; err != nil {
+		return err
+	}
+	for _, n := range notices {
+		var audience NoticeAudience
+		if err := json.Unmarshal([]byte(n.Audience), &audience); err != nil {
+			logging.Error("parse notice audience error: %v", err)
+			continue
+		}
+		if err := addNoticeRecipients(db, n.Id, audience); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 用户可见的广播通知
+func visibleBroadcastNotices(uid uint64) *gorm.DB {
+	// 只对注册之后发布的通知可见
+	registered := db.Model(&User{}).Select("created_at").Where("id = ?", uid)
+	marks := db.Model(&LogBroadcastNotice{}).Where("uid = ?", uid)
+	// 全体广播只发给普通用户，指定受众的按发送时的接收者
+	isUser := db.Model(&User{}).Select("1").Where("id = ? AND is_user = true AND active = true", uid)
+	recipients := db.Model(&NoticeRecipient{}).Select("notice_id").Where("uid = ?", uid)
+	return db.Model(&Notice{}).
+		Select("qnhd.notice.*", "COALESCE(l.is_read, false) as is_read").
+		Joins("LEFT JOIN (?) as l ON l.notice_id = qnhd.notice.id", marks).
+		Where("broadcast = true AND COALESCE(l.is_deleted, false) = false").
+		Where("((audience = '' AND EXISTS (?)) OR qnhd.notice.id IN (?))", isUser, recipients).
+		Where("COALESCE(pub_at, qnhd.notice.created_at) < ?", gorm.Expr("CURRENT_TIMESTAMP")).
+		Where("COALESCE(pub_at, qnhd.notice.created_at) >= COALESCE((?), '1970-01-01')", registered)
+}
+
+// 获取用户可见的广播通知
+func getBroadcastNotices(uid uint64) ([]broadcastResult, error) {
+	var ret = []broadcastResult{}
+	err := visibleBroadcastNotices(uid).Order("qnhd.notice.id DESC").Find(&ret).Error
+	return ret, err
+}
+
+// 标记广播通知
+func markBroadcastNotices(uid uint64, noticeIds []uint64, maps map[string]interface{}) error {
+	for _, id := range noticeIds {
+		var log LogBroadcastNotice
+		if err := db.Where(LogBroadcastNotice{Uid: uid, NoticeId: id}).
+			Assign(maps).FirstOrCreate(&log).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 已读广播通知
+func readBroadcastNotice(uid, noticeId uint64) error {
+	return markBroadcastNotices(uid, []uint64{noticeId}, map[string]interface{}{"is_read": true})
+}
+
+// 已读全部广播通知
+func readAllBroadcastNotices(uid uint64) error {
+	notices, err := getBroadcastNotices(uid)
+	if err != nil {
+		return err
+	}
+	var ids []uint64
+	for _, n := range notices {
+		if !n.IsRead {
+			ids = append(ids, n.Id)
+		}
+	}
+	return markBroadcastNotices(uid, ids, map[string]interface{}{"is_read": true})
+}
+
+// 删除广播通知
+func deleteBroadcastNotices(uid uint64, noticeIds []uint64) error {
+	return markBroadcastNotices(uid, noticeIds, map[string]interface{}{"is_deleted": true})
+}
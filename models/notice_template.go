@@ -1,10 +1,34 @@
 package models
 
 import (
+	"fmt"
 	"qnhd/enums/NoticeType"
+	"qnhd/enums/NotificationEventType"
+	"qnhd/pkg/logging"
 	"qnhd/pkg/template"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 默认语言
+const DEFAULT_LOCALE = "zh"
+
+// 系统通知模板信息
+type NoticeTemplateInfo struct {
+	Symbol    string   `json:"symbol"`
+	Args      []string `json:"args"`
+	Templates []Notice `json:"templates"`
+}
+
+// 系统通知对应的通知设置，未列出的按通知处理
+var noticeEvents = map[NoticeType.Enum]NotificationEventType.Enum{
+	NoticeType.FOLLOWED_TAG_NEW_POST: NotificationEventType.FOLLOWED_TAG_POST,
+	NoticeType.POST_LIKE_MILESTONE:   NotificationEventType.LIKE,
+	NoticeType.FLOOR_LIKE_MILESTONE:  NotificationEventType.LIKE,
+}
+
 func addNoticeWithTemplate(t NoticeType.Enum, uid []uint64, args []string) error {
 	if len(uid) == 0 {
 		return nil
@@ -13,5 +37,142 @@ func addNoticeWithTemplate(t NoticeType.Enum, uid []uint64, args []string) error
 	data["symbol"] = t.GetSymbol()
 	list := t.GetArgs()
 	data["args"] = template.GeneArgs(list, args)
-	return addUnreadNoticeToUser(uid, data)
+	if event, ok := noticeEvents[t]; ok {
+		data["event"] = event
+	}
+	err := addUnreadNoticeToUser(uid, data)
+	if err != nil {
+		logging.Error("add notice with template %s error: %v", t.GetSymbol(), err)
+	}
+	return err
+}
+
+// 校验系统通知模板的参数，非系统通知不做校验
+func ValidNoticeTemplate(symbol, content string) error {
+	t, ok := NoticeType.FromSymbol(symbol)
+	if !ok {
+		return nil
+	}
+	return template.Validate(content, t.GetArgs())
+}
+
+// 按语言筛选模板，加入语言之前的模板没有语言，视为默认语言
+func localeIs(locale string) clause.Expr {
+	return gorm.Expr("COALESCE(locale, ?) = ?", DEFAULT_LOCALE, locale)
+}
+
+// 获取模板，不存在对应语言时使用默认语言
+func getNoticeTemplate(symbol, locale string) (Notice, error) {
+	var notice Notice
+	if locale != "" && locale != DEFAULT_LOCALE {
+		if err := db.Where("symbol = ?", symbol).Where(localeIs(locale)).Find(&notice).Error; err != nil {
+			return notice, err
+		}
+		if notice.Id > 0 {
+			return notice, nil
+		}
+	}
+	if err := db.Where("symbol = ?", symbol).Where(localeIs(DEFAULT_LOCALE)).Find(&notice).Error; err != nil {
+		return notice, err
+	}
+	if notice.Id == 0 {
+		return notice, fmt.Errorf("通知模板 %s 不存在", symbol)
+	}
+	return notice, nil
+}
+
+// 获取所有系统通知模板
+func GetNoticeTemplates() ([]NoticeTemplateInfo, error) {
+	var ret = []NoticeTemplateInfo{}
+	for _, t := range NoticeType.All {
+		var notices = []Notice{}
+		if err := db.Where("symbol = ?", t.GetSymbol()).Order("locale").Find(&notices).Error; err != nil {
+			return ret, err
+		}
+		ret = append(ret, NoticeTemplateInfo{
+			Symbol:    t.GetSymbol(),
+			Args:      t.GetArgs(),
+			Templates: notices,
+		})
+	}
+	return ret, nil
+}
+
+// 后加入的系统通知的默认模板
+var defaultNoticeTemplates = []struct {
+	Type    NoticeType.Enum
+	Title   string
+	Content string
+}{
+	{NoticeType.POST_LIKE_MILESTONE, "点赞通知", "你的帖子「<post>」获得了<count>个赞"},
+	{NoticeType.FLOOR_LIKE_MILESTONE, "点赞通知", "你在帖子「<post>」中的评论「<floor>」获得了<count>个赞"},
+}
+
+// 创建不存在的默认模板
+func SetupNoticeTemplates() error {
+	for _, t := range defaultNoticeTemplates {
+		var cnt int64
+		if err := db.Model(&Notice{}).Where("symbol = ?", t.Type.GetSymbol()).Count(&cnt).Error; err != nil {
+			return err
+		}
+		if cnt > 0 {
+			continue
+		}
+		if _, err := AddNoticeTemplate(map[string]interface{}{
+			"sender":  "系统通知",
+			"title":   t.Title,
+			"content": t.Content,
+			"symbol":  t.Type.GetSymbol(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 检查缺失的系统通知模板
+func CheckNoticeTemplates() ([]string, error) {
+	var (
+		missing []string
+		symbols []string
+	)
+	if err := db.Model(&Notice{}).Distinct("symbol").Where(localeIs(DEFAULT_LOCALE)).Find(&symbols).Error; err != nil {
+		return nil, err
+	}
+	exists := map[string]bool{}
+	for _, s := range symbols {
+		exists[s] = true
+	}
+	for _, t := range NoticeType.All {
+		if !exists[t.GetSymbol()] {
+			missing = append(missing, t.GetSymbol())
+		}
+	}
+	return missing, nil
+}
+
+// 用示例参数预览模板，未给出的参数以参数名代替
+func PreviewNoticeTemplate(symbol, content string, args map[string]string) (string, error) {
+	var sample = map[string]string{}
+	t, ok := NoticeType.FromSymbol(symbol)
+	if ok {
+		for _, a := range t.GetArgs() {
+			sample[a] = fmt.Sprintf("[%s]", a)
+		}
+	}
+	for k, v := range args {
+		sample[k] = v
+	}
+	return template.Render(content, sample), ValidNoticeTemplate(symbol, content)
+}
+
+// 从请求语言中取出主语言
+func ParseLocale(lang string) string {
+	lang = strings.TrimSpace(strings.Split(lang, ",")[0])
+	lang = strings.Split(strings.Split(lang, ";")[0], "-")[0]
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return DEFAULT_LOCALE
+	}
+	return lang
 }
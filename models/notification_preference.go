@@ -0,0 +1,143 @@
+package models
+
+import (
+	"fmt"
+	"qnhd/enums/NotificationEventType"
+)
+
+const (
+	// 站内消息
+	NOTIFY_IN_APP = "in_app"
+	// 推送
+	NOTIFY_PUSH = "push"
+)
+
+// 用户通知偏好，没有记录时默认全部开启
+type NotificationPreference struct {
+	Uid   uint64                     `json:"-"`
+	Event NotificationEventType.Enum `json:"event"`
+	InApp bool                       `json:"in_app" gorm:"default:true"`
+	Push  bool                       `json:"push" gorm:"default:true"`
+}
+
+type NotificationPreferenceResponse struct {
+	NotificationPreference
+	Symbol          string `json:"symbol"`
+	CanDisableInApp bool   `json:"can_disable_in_app"`
+}
+
+// 屏蔽帖子
+type PostMute struct {
+	Uid       uint64 `json:"uid"`
+	PostId    uint64 `json:"post_id"`
+	CreatedAt string `json:"created_at" gorm:"default:null;"`
+}
+
+func GetNotificationPreferences(uid uint64) ([]NotificationPreferenceResponse, error) {
+	var (
+		prefs []NotificationPreference
+		ret   = []NotificationPreferenceResponse{}
+	)
+	if err := db.Where("uid = ?", uid).Find(&prefs).Error; err != nil {
+		return ret, err
+	}
+	for _, e := range NotificationEventType.All {
+		var r = NotificationPreferenceResponse{
+			NotificationPreference: NotificationPreference{Uid: uid, Event: e, InApp: true, Push: true},
+			Symbol:                 e.GetSymbol(),
+			CanDisableInApp:        e.CanDisableInApp(),
+		}
+		for _, p := range prefs {
+			if p.Event == e {
+				r.InApp = p.InApp || !e.CanDisableInApp()
+				r.Push = p.Push
+			}
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func EditNotificationPreference(uid uint64, event NotificationEventType.Enum, inApp, push bool) error {
+	if !inApp && !event.CanDisableInApp() {
+		return fmt.Errorf("该类消息不能关闭")
+	}
+	var pref NotificationPreference
+	return db.Where(NotificationPreference{Uid: uid, Event: event}).
+		Assign(map[string]interface{}{"in_app": inApp, "push": push}).
+		FirstOrCreate(&pref).Error
+}
+
+func MutePost(uid, postId uint64) error {
+	var mute = PostMute{Uid: uid, PostId: postId}
+	return db.FirstOrCreate(&mute, mute).Error
+}
+
+func UnmutePost(uid, postId uint64) error {
+	return db.Where("uid = ? AND post_id = ?", uid, postId).Delete(&PostMute{}).Error
+}
+
+func IsMutePostByUid(uid, postId string) bool {
+	var cnt int64
+	if err := db.Model(&PostMute{}).Where("uid = ? AND post_id = ?", uid, postId).Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+// 过滤掉关闭了该类通知或屏蔽了帖子的用户，postId为0时不检查屏蔽
+func filterNotifyUids(uids []uint64, event NotificationEventType.Enum, channel string, postId uint64) []uint64 {
+	if len(uids) == 0 {
+		return uids
+	}
+	if channel == NOTIFY_IN_APP && !event.CanDisableInApp() {
+		return uids
+	}
+	var off []uint64
+	db.Model(&NotificationPreference{}).Select("uid").
+		Where("uid IN (?) AND event = ? AND "+channel+" = false", uids, event).Find(&off)
+	if postId > 0 {
+		var muted []uint64
+		db.Model(&PostMute{}).Select("uid").Where("uid IN (?) AND post_id = ?", uids, postId).Find(&muted)
+		off = append(off, muted...)
+	}
+	if len(off) == 0 {
+		return uids
+	}
+	var (
+		skip = map[uint64]bool{}
+		ret  []uint64
+	)
+	for _, u := range off {
+		skip[u] = true
+	}
+	for _, u := range uids {
+		if !skip[u] {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+// 关闭了该类通知的所有用户，用于全体推送
+func getNotifyDisabledUids(event NotificationEventType.Enum, channel string) map[uint64]bool {
+	var (
+		off []uint64
+		ret = map[uint64]bool{}
+	)
+	db.Model(&NotificationPreference{}).Select("uid").Where("event = ? AND "+channel+" = false", event).Find(&off)
+	for _, u := range off {
+		ret[u] = true
+	}
+	return ret
+}
+
+// 根据uid获取学号，用于推送
+func getNumbersByUids(uids []uint64) []string {
+	var numbers []string
+	if len(uids) == 0 {
+		return numbers
+	}
+	db.Model(&User{}).Select("number").Where("id IN (?)", uids).Find(&numbers)
+	return numbers
+}
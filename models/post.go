@@ -76,7 +76,7 @@ type LogPostDis struct {
 // 帖子返回数据
 type PostResponse struct {
 	Post
-	Tag          *Tag            `json:"tag"`
+	Tags         []Tag           `json:"tags"`
 	Floors       []FloorResponse `json:"floors"`
 	CommentCount int             `json:"comment_count"`
 	ImageUrls    []string        `json:"image_urls"`
@@ -89,7 +89,7 @@ type PostResponse struct {
 // 客户端帖子返回数据
 type PostResponseUser struct {
 	Post
-	Tag          *Tag                `json:"tag"`
+	Tags         []Tag               `json:"tags"`
 	Floors       []FloorResponseUser `json:"floors"`
 	CommentCount int                 `json:"comment_count"`
 	ImageUrls    []string            `json:"image_urls"`
@@ -98,9 +98,12 @@ type PostResponseUser struct {
 	IsLike     bool `json:"is_like"`
 	IsDis      bool `json:"is_dis"`
 	IsFav      bool `json:"is_fav"`
+	IsMuted    bool `json:"is_muted"`
 	IsOwner    bool `json:"is_owner"`
 	IsDeleted  bool `json:"is_deleted"`
 	VisitCount int  `json:"visit_count"`
+	// 独立访客数
+	UniqueVisitCount int `json:"unique_visit_count"`
 	// 用于处理链式数据
 	Error error `json:"-"`
 }
@@ -132,10 +135,8 @@ func (p *Post) geneResponse(unscoped bool) PostResponse {
 		}
 		pr.Department = &d
 	}
-	tag, _ := GetTagInPost(util.AsStrU(p.Id))
-	if tag != nil {
-		pr.Tag = tag
-	}
+	tags, _ := GetTagsInPost(util.AsStrU(p.Id))
+	pr.Tags = tags
 	pr.Error = err
 	pr.IsDeleted = pr.DeletedAt.Valid
 	return pr
@@ -144,16 +145,19 @@ func (p *Post) geneResponse(unscoped bool) PostResponse {
 func (p PostResponse) searchByUid(uid string) PostResponseUser {
 	pr := PostResponseUser{
 		Post:         p.Post,
-		Tag:          p.Tag,
+		Tags:         p.Tags,
 		CommentCount: p.CommentCount,
 		ImageUrls:    p.ImageUrls,
 		Department:   p.Department,
 		IsLike:       IsLikePostByUid(uid, util.AsStrU(p.Id)),
 		IsDis:        IsDisPostByUid(uid, util.AsStrU(p.Id)),
 		IsFav:        IsFavPostByUid(uid, util.AsStrU(p.Id)),
+		IsMuted:      IsMutePostByUid(uid, util.AsStrU(p.Id)),
 		IsOwner:      IsOwnPostByUid(uid, util.AsStrU(p.Id)),
-		VisitCount:   GetPostVisitCount(util.AsStrU(p.Id)),
 	}
+	visit := getPostVisitCount(p.Id)
+	pr.VisitCount = int(visit.Total)
+	pr.UniqueVisitCount = int(visit.UniqueCount)
 
 	// frs, err := getShortFloorResponsesInPostWithUid(util.AsStrU(p.Id), uid)
 	// if err != nil {
@@ -202,9 +206,7 @@ func transPostsToResponsesWithUid(posts *[]Post, uid string) ([]PostResponseUser
 }
 
 func GetPostVisitCount(postId string) int {
-	var cnt int64
-	db.Model(&LogVisitHistory{}).Where("post_id = ?", postId).Count(&cnt)
-	return int(cnt)
+	return int(getPostVisitCount(util.AsUint(postId)).Total)
 }
 
 func GetPost(postId string) (Post, error) {
@@ -289,9 +291,11 @@ func getPosts(c *gin.Context, maps map[string]interface{}) ([]Post, int, error)
 	}
 
 	// 当搜索不为空时加上全文检索
+	table := "qnhd.post"
 	if content != "" {
+		table = "p"
 		d = db.Select("p.*", "ts_rank(p.tokens, q) as score").
-			Table("(?) as p, plainto_tsquery(?) as q", d, segment.Cut(content, " ")).
+			Table("(?) as p CROSS JOIN plainto_tsquery(?) as q", d, segment.Cut(content, " ")).
 			Where("q @@ p.tokens").Order("score DESC")
 	}
 	// 排序方式
@@ -299,6 +303,11 @@ func getPosts(c *gin.Context, maps map[string]interface{}) ([]Post, int, error)
 		d = d.Order("created_at DESC")
 	} else if searchMode == PostSearchModeType.UPDATE {
 		d = d.Order("updated_at DESC")
+	} else if searchMode == PostSearchModeType.TRENDING {
+		// 分数只在定时任务中变化，没有分数的排在最后，加上id保证分页稳定
+		d = d.Joins("LEFT JOIN (SELECT post_id, score AS trending_score FROM qnhd.post_trending) AS pt ON pt.post_id = " + table + ".id").
+			Order("pt.trending_score DESC NULLS LAST").
+			Order(table + ".id DESC")
 	}
 
 	// 分区 不为全部时加上区分
@@ -390,16 +399,24 @@ func GetFavPostResponseWithUid(c *gin.Context, uid string) ([]PostResponseUser,
 }
 
 func GetHistoryPostResponseWithUid(c *gin.Context, uid string) ([]PostResponseUser, error) {
-	var posts []Post
-	var ids []string
-	if err := db.Model(&LogVisitHistory{}).Where("uid = ?", uid).Order("created_at DESC").Distinct("post_id").Scopes(util.Paginate(c)).Find(&ids).Error; err != nil {
+	var posts, ordered []Post
+	ids, err := getHistoryPostIds(c, uid)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Where("id IN (?)", ids).Scopes(util.Paginate(c)).Find(&posts).Error; err != nil {
+	if err := db.Where("id IN (?)", ids).Find(&posts).Error; err != nil {
 		return nil, err
 	}
-	return transPostsToResponsesWithUid(&posts, uid)
+	// 按浏览时间排序，已删除的帖子跳过
+	for _, id := range ids {
+		for _, p := range posts {
+			if p.Id == id {
+				ordered = append(ordered, p)
+			}
+		}
+	}
+	return transPostsToResponsesWithUid(&ordered, uid)
 }
 
 func AddPost(maps map[string]interface{}) (uint64, error) {
@@ -438,6 +455,7 @@ func AddPost(maps map[string]interface{}) (uint64, error) {
 		})
 	} else if IsValidPostType(post.Type) {
 		imgs, img_ok := maps["image_urls"].([]string)
+		var added []uint64
 		err = db.Transaction(func(tx *gorm.DB) error {
 			if err := tx.Create(post).Error; err != nil {
 				return err
@@ -447,17 +465,25 @@ func AddPost(maps map[string]interface{}) (uint64, error) {
 					return err
 				}
 			}
-			// 如果有tag_id
-			tagId, ok := maps["tag_id"].(string)
+			// 如果有tag_ids
+			tagIds, ok := maps["tag_ids"].([]uint64)
 			if ok {
-				if err := AddPostWithTag(tx, post.Id, util.AsUint(tagId)); err != nil {
+				var err error
+				added, err = AddPostWithTags(tx, post.Id, tagIds)
+				if err != nil {
 					return err
 				}
 				// 对帖子的tag增加记录
-				addTagLog(util.AsUint(tagId), TagPointType.ADD_POST)
+				for _, id := range added {
+					addTagLog(id, TagPointType.ADD_POST)
+				}
 			}
 			return nil
 		})
+		if err == nil {
+			// 通知关注tag的用户，关注的人多时较慢，不阻塞发帖
+			go notifyTagFollowers(*post, added)
+		}
 	} else {
 		return 0, fmt.Errorf("invalid post type")
 	}
@@ -467,6 +493,10 @@ func AddPost(maps map[string]interface{}) (uint64, error) {
 	if err := flushPostTokens(post.Id, post.Title, post.Content); err != nil {
 		return 0, err
 	}
+	// 记录指纹用于重复检测
+	if err := addContentHash(ReportType.POST, post.Id, uid, post.Id, postHashText(post.Title, post.Content)); err != nil {
+		logging.Error("add content hash error: %v", err)
+	}
 
 	return post.Id, nil
 }
@@ -790,6 +820,7 @@ func LikePost(postId string, uid string) (uint64, error) {
 		addTagLogInPost(post.Id, TagPointType.LIKE_POST)
 	}
 	addUnreadLike(post.Uid, LikeType.POST, post.Id)
+	addLikeMilestone(post.Uid, LikeType.POST, post.Id, post.LikeCount)
 	UnDisPost(postId, uid)
 	return post.LikeCount, nil
 }
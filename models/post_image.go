@@ -35,10 +35,21 @@ func AddImageInPost(tx *gorm.DB, postId uint64, imageUrls []string) error {
 			ImageUrl: url,
 		})
 	}
-	err := tx.Create(&pis).Error
-	return err
+	if err := tx.Create(&pis).Error; err != nil {
+		return err
+	}
+	return refImages(tx, imageUrls, 1)
 }
 
 func DeletePostImages(postId string) error {
-	return db.Where("post_id = ?", postId).Delete(&PostImage{}).Error
+	return db.Transaction(func(tx *gorm.DB) error {
+		var urls []string
+		if err := tx.Model(&PostImage{}).Select("image_url").Where("post_id = ?", postId).Find(&urls).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id = ?", postId).Delete(&PostImage{}).Error; err != nil {
+			return err
+		}
+		return refImages(tx, urls, -1)
+	})
 }
@@ -31,6 +31,8 @@ func AddImageInPostReply(tx *gorm.DB, replyId uint64, imageUrls []string) error
 			ImageUrl:    url,
 		})
 	}
-	err := tx.Create(&pis).Error
-	return err
+	if err := tx.Create(&pis).Error; err != nil {
+		return err
+	}
+	return refImages(tx, imageUrls, 1)
 }
@@ -1,7 +1,10 @@
 package models
 
 import (
-	"errors"
+	"fmt"
+	"qnhd/enums/TagPointType"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/util"
 
 	"gorm.io/gorm"
 )
@@ -11,34 +14,80 @@ type PostTag struct {
 	TagId  uint64 `json:"tag_id"`
 }
 
-func GetTagInPost(postId string) (*Tag, error) {
-	var tag *Tag
-	if err := db.Joins("JOIN qnhd.post_tag as pt ON qnhd.tag.id = pt.tag_id").Where("post_id = ?", postId).First(&tag).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil
-		} else {
-			return tag, err
+func GetTagsInPost(postId string) ([]Tag, error) {
+	var tags = []Tag{}
+	err := db.Joins("JOIN qnhd.post_tag as pt ON qnhd.tag.id = pt.tag_id").Where("post_id = ?", postId).Order("id").Find(&tags).Error
+	return tags, err
+}
+
+func getTagIdsInPost(tx *gorm.DB, postId uint64) ([]uint64, error) {
+	var ids []uint64
+	err := tx.Model(&PostTag{}).Select("tag_id").Where("post_id = ?", postId).Find(&ids).Error
+	return ids, err
+}
+
+// 给帖子添加tag，已有的tag会被忽略，返回新增的tag
+func AddPostWithTags(tx *gorm.DB, postId uint64, tagIds []uint64) ([]uint64, error) {
+	if tx == nil {
+		tx = db
+	}
+	tagIds = util.SetUint64(tagIds)
+	if len(tagIds) == 0 {
+		return nil, nil
+	}
+	// 先查询是否有tag
+	var cnt int64
+	if err := tx.Model(&Tag{}).Where("id IN (?)", tagIds).Count(&cnt).Error; err != nil {
+		return nil, err
+	}
+	if int(cnt) != len(tagIds) {
+		return nil, fmt.Errorf("tag不存在")
+	}
+	exists, err := getTagIdsInPost(tx, postId)
+	if err != nil {
+		return nil, err
+	}
+	var news []PostTag
+	var added []uint64
+	for _, id := range tagIds {
+		found := false
+		for _, e := range exists {
+			if e == id {
+				found = true
+				break
+			}
 		}
+		if !found {
+			news = append(news, PostTag{PostId: postId, TagId: id})
+			added = append(added, id)
+		}
+	}
+	if len(exists)+len(news) > setting.AppSetting.MaxPostTags {
+		return nil, fmt.Errorf("每个帖子最多%d个tag", setting.AppSetting.MaxPostTags)
 	}
-	return tag, nil
+	if len(news) == 0 {
+		return nil, nil
+	}
+	return added, tx.Create(&news).Error
 }
 
 func AddPostWithTag(tx *gorm.DB, postId uint64, tagId uint64) error {
+	_, err := AddPostWithTags(tx, postId, []uint64{tagId})
+	return err
+}
+
+// 删除帖子的部分tag
+func DeleteTagsInPost(tx *gorm.DB, postId uint64, tagIds []uint64) error {
 	if tx == nil {
 		tx = db
 	}
-	// 先查询是否有tag
-	var tag Tag
-	if err := tx.Where("id = ?", tagId).First(&tag).Error; err != nil {
-		return err
+	if len(tagIds) == 0 {
+		return nil
 	}
-	err := tx.Create(&PostTag{
-		PostId: postId,
-		TagId:  tagId,
-	}).Error
-	return err
+	return tx.Where("post_id = ? AND tag_id IN (?)", postId, tagIds).Delete(&PostTag{}).Error
 }
 
+// 删除帖子的全部tag
 func DeleteTagInPost(tx *gorm.DB, postId uint64) error {
 	if tx == nil {
 		tx = db
@@ -46,3 +95,35 @@ func DeleteTagInPost(tx *gorm.DB, postId uint64) error {
 	err := tx.Where("post_id = ?", postId).Delete(&PostTag{}).Error
 	return err
 }
+
+// 发帖人修改帖子的tag
+func EditPostTags(uid, postId string, addIds, removeIds []uint64) error {
+	var post Post
+	if err := db.Where("id = ?", postId).First(&post).Error; err != nil {
+		return err
+	}
+	if util.AsStrU(post.Uid) != uid {
+		return fmt.Errorf("无权修改")
+	}
+	if post.Type == POST_SCHOOL_TYPE {
+		return fmt.Errorf("校务帖不能添加tag")
+	}
+	var added []uint64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := DeleteTagsInPost(tx, post.Id, removeIds); err != nil {
+			return err
+		}
+		var err error
+		added, err = AddPostWithTags(tx, post.Id, addIds)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// 新加的tag计入热度
+	for _, id := range added {
+		addTagLog(id, TagPointType.ADD_POST)
+	}
+	go notifyTagFollowers(post, added)
+	return nil
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"qnhd/pkg/setting"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 热门帖子分数
+type PostTrending struct {
+	PostId uint64 `json:"post_id"`
+	// 未衰减的热度
+	Points float64 `json:"points"`
+	// 衰减后的分数
+	Score     float64 `json:"score"`
+	CreatedAt string  `json:"created_at" gorm:"default:null;"`
+	UpdatedAt string  `json:"updated_at" gorm:"default:null;"`
+}
+
+var (
+	trendingLock    sync.Mutex
+	trendingLastRun time.Time
+)
+
+// 计算热度的帖子，只取时间窗口内的
+const trendingPointsSql = `SELECT p.id AS post_id,
+	p.like_count * @like + p.fav_count * @fav +
+	COALESCE((SELECT COUNT(*) FROM qnhd.floor AS f WHERE f.post_id = p.id AND f.deleted_at IS NULL), 0) * @floor +
+	COALESCE((SELECT v.unique_count FROM qnhd.post_visit_count AS v WHERE v.post_id = p.id), 0) * @visit AS points,
+	p.created_at, CURRENT_TIMESTAMP AS updated_at
+FROM qnhd.post AS p
+WHERE p.deleted_at IS NULL AND p.created_at >= @from`
+
+// 更新热门分数，full为false时只重新计算上次之后有变化的帖子
+func FlushPostTrending(full bool) error {
+	trendingLock.Lock()
+	defer trendingLock.Unlock()
+	t := setting.TrendingSetting
+	now := time.Now()
+	args := map[string]interface{}{
+		"like":    t.LikeWeight,
+		"fav":     t.FavWeight,
+		"floor":   t.FloorWeight,
+		"visit":   t.VisitWeight,
+		"from":    now.AddDate(0, 0, -t.WindowDays),
+		"since":   trendingLastRun,
+		"gravity": t.Gravity,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		changed := trendingPointsSql
+		if !full && !trendingLastRun.IsZero() {
+			changed += " AND (p.updated_at >= @since OR p.id NOT IN (SELECT post_id FROM qnhd.post_trending))"
+		}
+		// 重新计算有变化的帖子
+		if err := tx.Exec("DELETE FROM qnhd.post_trending WHERE post_id IN (SELECT post_id FROM ("+changed+") AS c)", args).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("INSERT INTO qnhd.post_trending (post_id, points, created_at, updated_at) SELECT * FROM ("+changed+") AS c", args).Error; err != nil {
+			return err
+		}
+		// 移出时间窗口和已删除的帖子
+		if err := tx.Exec(`DELETE FROM qnhd.post_trending WHERE created_at < @from
+			OR post_id IN (SELECT id FROM qnhd.post WHERE deleted_at IS NOT NULL)`, args).Error; err != nil {
+			return err
+		}
+		// 衰减对所有帖子都要重新计算
+		return tx.Exec(`UPDATE qnhd.post_trending SET score =
+			points / POWER(EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - created_at)) / 3600 + 2, @gravity)`, args).Error
+	})
+	if err == nil {
+		trendingLastRun = now
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"qnhd/pkg/ratelimit"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 数据库中的令牌桶，多实例共享
+type RateBucket struct {
+	Uid       uint64 `gorm:"primaryKey"`
+	Action    string `gorm:"primaryKey"`
+	Tokens    float64
+	UpdatedAt time.Time `gorm:"autoUpdateTime:false"`
+}
+
+// 使用数据库计数取出一个令牌
+func TakeRateToken(uid uint64, rule ratelimit.Rule) (bool, time.Duration, error) {
+	var (
+		ok   bool
+		wait time.Duration
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var b RateBucket
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("uid = ? AND action = ?", uid, rule.Action).Find(&b).Error
+		if err != nil {
+			return err
+		}
+		bucket := ratelimit.Bucket{Tokens: b.Tokens, UpdatedAt: b.UpdatedAt}
+		ok, wait = rule.Take(&bucket, time.Now())
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&RateBucket{
+			Uid:       uid,
+			Action:    rule.Action,
+			Tokens:    bucket.Tokens,
+			UpdatedAt: bucket.UpdatedAt,
+		}).Error
+	})
+	return ok, wait, err
+}
+
+// 清理一天未更新的令牌桶
+func FlushRateBuckets() (int64, error) {
+	res := db.Where("updated_at < ?", time.Now().Add(-24*time.Hour)).Delete(&RateBucket{})
+	return res.RowsAffected, res.Error
+}
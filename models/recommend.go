@@ -0,0 +1,368 @@
+package models
+
+import (
+	"fmt"
+	"qnhd/pkg/segment"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/util"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 不同行为的兴趣权重
+const (
+	interestFav   = 3.0
+	interestLike  = 2.0
+	interestVisit = 1.0
+)
+
+// 各部分分数的占比
+const (
+	recommendTagWeight      = 0.4
+	recommendTypeWeight     = 0.15
+	recommendKeywordWeight  = 0.25
+	recommendTrendingWeight = 0.1
+	recommendFreshWeight    = 0.1
+)
+
+// 兴趣关键词的数量
+const interestKeywordCount = 20
+
+type RecommendPostResponse struct {
+	PostResponseUser
+	// 推荐理由
+	Reasons []string `json:"reasons"`
+}
+
+// 用户兴趣
+type interestProfile struct {
+	tags     map[uint64]float64
+	types    map[int]float64
+	keywords map[string]float64
+}
+
+func (p *interestProfile) isEmpty() bool {
+	return len(p.tags) == 0 && len(p.types) == 0 && len(p.keywords) == 0
+}
+
+// 候选帖子
+type recommendCandidate struct {
+	post     Post
+	tags     []uint64
+	trending float64
+	fresh    float64
+	score    float64
+	reasons  []string
+}
+
+// 根据收藏、点赞和浏览记录生成兴趣
+func getInterestProfile(uid uint64) (interestProfile, error) {
+	var (
+		profile = interestProfile{
+			tags:     map[uint64]float64{},
+			types:    map[int]float64{},
+			keywords: map[string]float64{},
+		}
+		favs, likes, visits []uint64
+	)
+	if err := db.Model(&LogPostFav{}).Select("post_id").Where("uid = ?", uid).Find(&favs).Error; err != nil {
+		return profile, err
+	}
+	if err := db.Model(&LogPostLike{}).Select("post_id").Where("uid = ?", uid).Find(&likes).Error; err != nil {
+		return profile, err
+	}
+	// 只使用用户自己管理的浏览记录
+	if err := db.Model(&UserVisitHistory{}).Select("post_id").Where("uid = ?", uid).
+		Order("visited_at DESC").Limit(setting.RecommendSetting.HistoryLimit).Find(&visits).Error; err != nil {
+		return profile, err
+	}
+	weights := map[uint64]float64{}
+	for _, id := range favs {
+		weights[id] += interestFav
+	}
+	for _, id := range likes {
+		weights[id] += interestLike
+	}
+	for _, id := range visits {
+		weights[id] += interestVisit
+	}
+	if len(weights) == 0 {
+		return profile, nil
+	}
+	var ids []uint64
+	for id := range weights {
+		ids = append(ids, id)
+	}
+
+	var posts []Post
+	if err := db.Unscoped().Select("id", "type", "title").Where("id IN (?)", ids).Find(&posts).Error; err != nil {
+		return profile, err
+	}
+	for _, p := range posts {
+		w := weights[p.Id]
+		profile.types[p.Type] += w
+		for _, k := range strings.Split(segment.Cut(p.Title, " "), " ") {
+			// 过滤单字和标点
+			if utf8.RuneCountInString(k) >= 2 {
+				profile.keywords[k] += w
+			}
+		}
+	}
+	var pts []PostTag
+	if err := db.Where("post_id IN (?)", ids).Find(&pts).Error; err != nil {
+		return profile, err
+	}
+	for _, pt := range pts {
+		profile.tags[pt.TagId] += weights[pt.PostId]
+	}
+
+	// 只保留权重最高的关键词
+	if len(profile.keywords) > interestKeywordCount {
+		var ks []string
+		for k := range profile.keywords {
+			ks = append(ks, k)
+		}
+		sort.Slice(ks, func(i, j int) bool {
+			return profile.keywords[ks[i]] > profile.keywords[ks[j]]
+		})
+		for _, k := range ks[interestKeywordCount:] {
+			delete(profile.keywords, k)
+		}
+	}
+	return profile, nil
+}
+
+// 候选帖子，过滤掉自己的、看过的和点踩的
+func getRecommendCandidates(uid uint64) ([]recommendCandidate, error) {
+	var (
+		ret   []recommendCandidate
+		posts []Post
+	)
+	r := setting.RecommendSetting
+	if err := db.Where("created_at >= ? AND uid <> ?", time.Now().AddDate(0, 0, -r.WindowDays), uid).
+		Where("id NOT IN (?)", db.Model(&LogPostVisitor{}).Select("post_id").Where("uid = ?", uid)).
+		Where("id NOT IN (?)", db.Model(&LogPostDis{}).Select("post_id").Where("uid = ?", uid)).
+		Order("created_at DESC").Limit(r.CandidateLimit).Find(&posts).Error; err != nil {
+		return ret, err
+	}
+	if len(posts) == 0 {
+		return ret, nil
+	}
+	var ids []uint64
+	for _, p := range posts {
+		ids = append(ids, p.Id)
+	}
+	var pts []PostTag
+	if err := db.Where("post_id IN (?)", ids).Find(&pts).Error; err != nil {
+		return ret, err
+	}
+	var trendings []PostTrending
+	if err := db.Where("post_id IN (?)", ids).Find(&trendings).Error; err != nil {
+		return ret, err
+	}
+	// 热度按最大值归一化
+	var maxTrending float64
+	for _, t := range trendings {
+		if t.Score > maxTrending {
+			maxTrending = t.Score
+		}
+	}
+	now := time.Now()
+	for _, p := range posts {
+		c := recommendCandidate{post: p}
+		for _, pt := range pts {
+			if pt.PostId == p.Id {
+				c.tags = append(c.tags, pt.TagId)
+			}
+		}
+		for _, t := range trendings {
+			if t.PostId == p.Id && maxTrending > 0 {
+				c.trending = t.Score / maxTrending
+			}
+		}
+		if t, err := time.Parse(time.RFC3339Nano, p.CreatedAt); err == nil {
+			c.fresh = 1 / (1 + now.Sub(t).Hours()/24)
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+func maxWeight(m map[string]float64) float64 {
+	var max float64
+	for _, v := range m {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// 计算候选帖子的分数和推荐理由
+func (c *recommendCandidate) rank(profile interestProfile, tagNames map[uint64]string, typeNames map[int]string) {
+	var tagMax, typeMax float64
+	for _, v := range profile.tags {
+		if v > tagMax {
+			tagMax = v
+		}
+	}
+	for _, v := range profile.types {
+		if v > typeMax {
+			typeMax = v
+		}
+	}
+	var tagScore, typeScore, keywordScore float64
+	for _, t := range c.tags {
+		if w := profile.tags[t]; w > 0 && tagMax > 0 {
+			tagScore += w / tagMax
+			c.reasons = append(c.reasons, fmt.Sprintf("来自你常看的标签 #%s", tagNames[t]))
+		}
+	}
+	if w := profile.types[c.post.Type]; w > 0 && typeMax > 0 {
+		typeScore = w / typeMax
+		c.reasons = append(c.reasons, fmt.Sprintf("来自你常看的分区 %s", typeNames[c.post.Type]))
+	}
+	keywordMax := maxWeight(profile.keywords)
+	var matched []string
+	for k, w := range profile.keywords {
+		if strings.Contains(c.post.Title, k) || strings.Contains(c.post.Content, k) {
+			keywordScore += w / keywordMax
+			matched = append(matched, k)
+		}
+	}
+	if len(matched) > 0 {
+		sort.Slice(matched, func(i, j int) bool {
+			return profile.keywords[matched[i]] > profile.keywords[matched[j]]
+		})
+		if len(matched) > 3 {
+			matched = matched[:3]
+		}
+		c.reasons = append(c.reasons, fmt.Sprintf("包含你感兴趣的 %s", strings.Join(matched, "、")))
+	}
+	if tagScore > 1 {
+		tagScore = 1
+	}
+	if keywordScore > 1 {
+		keywordScore = 1
+	}
+	c.score = tagScore*recommendTagWeight +
+		typeScore*recommendTypeWeight +
+		keywordScore*recommendKeywordWeight +
+		c.trending*recommendTrendingWeight +
+		c.fresh*recommendFreshWeight
+}
+
+// 混入热门和最新的帖子，每5个中有1个热门、1个最新
+func blendRecommend(ranked []recommendCandidate) []recommendCandidate {
+	var (
+		trending = append([]recommendCandidate{}, ranked...)
+		fresh    = append([]recommendCandidate{}, ranked...)
+		used     = map[uint64]bool{}
+		ret      []recommendCandidate
+	)
+	sort.SliceStable(trending, func(i, j int) bool { return trending[i].trending > trending[j].trending })
+	sort.SliceStable(fresh, func(i, j int) bool { return fresh[i].fresh > fresh[j].fresh })
+	next := func(list []recommendCandidate, reason string) bool {
+		for _, c := range list {
+			if !used[c.post.Id] {
+				used[c.post.Id] = true
+				if reason != "" {
+					c.reasons = append([]string{reason}, c.reasons...)
+				}
+				ret = append(ret, c)
+				return true
+			}
+		}
+		return false
+	}
+	for len(ret) < len(ranked) {
+		switch len(ret) % 5 {
+		case 3:
+			if next(trending, "近期热门") {
+				continue
+			}
+		case 4:
+			if next(fresh, "最新发布") {
+				continue
+			}
+		}
+		next(ranked, "")
+	}
+	return ret
+}
+
+// 获取个性化推荐
+func GetRecommendPosts(c *gin.Context, uid string) ([]RecommendPostResponse, error) {
+	var ret = []RecommendPostResponse{}
+	profile, err := getInterestProfile(util.AsUint(uid))
+	if err != nil {
+		return ret, err
+	}
+	candidates, err := getRecommendCandidates(util.AsUint(uid))
+	if err != nil {
+		return ret, err
+	}
+
+	var tags []Tag
+	if len(profile.tags) > 0 {
+		var ids []uint64
+		for id := range profile.tags {
+			ids = append(ids, id)
+		}
+		db.Where("id IN (?)", ids).Find(&tags)
+	}
+	tagNames := map[uint64]string{}
+	for _, t := range tags {
+		tagNames[t.Id] = t.Name
+	}
+	var types []PostType
+	db.Find(&types)
+	typeNames := map[int]string{}
+	for _, t := range types {
+		typeNames[int(t.Id)] = t.Name
+	}
+
+	for i := range candidates {
+		candidates[i].rank(profile, tagNames, typeNames)
+	}
+	// 没有兴趣时按热度和时间排序
+	if profile.isEmpty() {
+		for i := range candidates {
+			candidates[i].score = candidates[i].trending*0.5 + candidates[i].fresh*0.5
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].post.Id > candidates[j].post.Id
+	})
+	candidates = blendRecommend(candidates)
+
+	offset, limit := util.PageRange(c)
+	// page或page_base为负数时从头开始
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(candidates) {
+		return ret, nil
+	}
+	if limit < 0 || offset+limit > len(candidates) {
+		limit = len(candidates) - offset
+	}
+	for _, cand := range candidates[offset : offset+limit] {
+		pr := cand.post.geneResponse(false).searchByUid(uid)
+		if pr.Error != nil {
+			continue
+		}
+		if cand.reasons == nil {
+			cand.reasons = []string{}
+		}
+		ret = append(ret, RecommendPostResponse{PostResponseUser: pr, Reasons: cand.reasons})
+	}
+	return ret, nil
+}
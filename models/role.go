@@ -0,0 +1,633 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/enums/PermissionType"
+	"qnhd/enums/ReportType"
+	"qnhd/pkg/util"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 角色，包含一组权限
+type Role struct {
+	Id          uint64 `json:"id" gorm:"primaryKey;autoIncrement;"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// 内置角色不能删除
+	Builtin bool `json:"builtin" gorm:"default:false"`
+	// 拥有该角色的用户必须开启两步验证
+	RequireTotp bool     `json:"require_totp" gorm:"default:false"`
+	CreatedAt   string   `json:"created_at" gorm:"autoCreateTime;default:null;"`
+	Permissions []string `json:"permissions" gorm:"-"`
+}
+
+type RolePermission struct {
+	RoleId     uint64 `json:"role_id"`
+	Permission string `json:"permission"`
+}
+
+// 用户的角色，部门和帖子类型为0时不限范围
+type UserRole struct {
+	Id           uint64 `json:"id" gorm:"primaryKey;autoIncrement;"`
+	Uid          uint64 `json:"uid"`
+	RoleId       uint64 `json:"role_id"`
+	DepartmentId uint64 `json:"department_id" gorm:"default:0"`
+	PostType     int    `json:"post_type" gorm:"default:0"`
+	CreatedAt    string `json:"created_at" gorm:"autoCreateTime;default:null;"`
+}
+
+type UserRoleDetail struct {
+	UserRole
+	RoleName string `json:"role_name"`
+}
+
+// 权限的作用范围
+type Scope struct {
+	DepartmentId uint64
+	PostType     int
+}
+
+// 帖子所在的范围
+func PostScope(post Post) Scope {
+	return Scope{DepartmentId: post.DepartmentId, PostType: post.Type}
+}
+
+// 帖子所在的范围，包括已删除的帖子
+func PostScopeById(postId uint64) (Scope, error) {
+	var post Post
+	if err := db.Unscoped().Where("id = ?", postId).First(&post).Error; err != nil {
+		return Scope{}, err
+	}
+	return PostScope(post), nil
+}
+
+// 楼层所在帖子的范围，包括已删除的楼层
+func FloorScopeById(floorId uint64) (Scope, error) {
+	var floor Floor
+	if err := db.Unscoped().Where("id = ?", floorId).First(&floor).Error; err != nil {
+		return Scope{}, err
+	}
+	return PostScopeById(floor.PostId)
+}
+
+// 暂扣内容发布后所在的范围
+func HeldContentScope(id uint64) (Scope, error) {
+	var h HeldContent
+	if err := db.Where("id = ?", id).First(&h).Error; err != nil {
+		return Scope{}, err
+	}
+	if h.Kind == ReportType.POST {
+		var data heldData
+		if err := json.Unmarshal([]byte(h.Data), &data); err != nil {
+			return Scope{}, err
+		}
+		return Scope{DepartmentId: data.DepartmentId, PostType: data.Type}, nil
+	}
+	if h.PostId == 0 {
+		return FloorScopeById(h.ReplyTo)
+	}
+	return PostScopeById(h.PostId)
+}
+
+const (
+	ROLE_SUPER                = "super"
+	ROLE_SCH_ADMIN            = "sch_admin"
+	ROLE_STU_ADMIN            = "stu_admin"
+	ROLE_SCH_DISTRIBUTE_ADMIN = "sch_distribute_admin"
+)
+
+// 内置角色，对应原来user表中的管理员标记
+var builtinRoles = []struct {
+	Name        string
+	Description string
+	// user表中的标记，和角色保持同步
+	Column      string
+	Permissions []PermissionType.Enum
+}{
+	{ROLE_SUPER, "超级管理员", "super_admin", PermissionType.All()},
+	{ROLE_SCH_ADMIN, "部门管理员", "school_department_admin", []PermissionType.Enum{
+		PermissionType.NOTICE_PUBLISH,
+		PermissionType.POST_REPLY,
+		PermissionType.POST_TRANSFER,
+	}},
+	{ROLE_STU_ADMIN, "学生管理员", "student_admin", []PermissionType.Enum{
+		PermissionType.USER_BLOCK,
+		PermissionType.POST_FEATURE,
+		PermissionType.POST_DELETE,
+		PermissionType.POST_MODERATE,
+		PermissionType.FLOOR_DELETE,
+	}},
+	{ROLE_SCH_DISTRIBUTE_ADMIN, "校务分发管理员", "school_distribute_admin", []PermissionType.Enum{
+		PermissionType.POST_DISTRIBUTE,
+		PermissionType.POST_DELETE,
+		PermissionType.FLOOR_DELETE,
+		PermissionType.DEPARTMENT_ALL,
+	}},
+}
+
+var (
+	ErrRoleBuiltin   = errors.New("内置角色不能修改")
+	ErrLastSuperRole = errors.New("至少保留一个超级管理员")
+	// 只能分配自己拥有的权限，只能管理权限不超过自己的账号
+	ErrPermissionExceeded = errors.New("权限超出自己拥有的范围")
+)
+
+// 创建内置角色，并把user表中的管理员标记迁移为角色
+func SetupRoles() error {
+	for _, b := range builtinRoles {
+		var role Role
+		if err := db.Where("name = ?", b.Name).Find(&role).Error; err != nil {
+			return err
+		}
+		if role.Id == 0 {
+			role = Role{Name: b.Name, Description: b.Description, Builtin: true}
+			if err := db.Create(&role).Error; err != nil {
+				return err
+			}
+			if err := setRolePermissions(db, role.Id, b.Permissions); err != nil {
+				return err
+			}
+		} else if b.Name == ROLE_SUPER {
+			// 超级管理员始终拥有新增的权限
+			if err := setRolePermissions(db, role.Id, b.Permissions); err != nil {
+				return err
+			}
+		}
+		if err := db.Exec(`INSERT INTO qnhd.user_role (uid, role_id) SELECT u.id, ? FROM qnhd.user AS u
+			WHERE u.`+b.Column+` = true AND NOT EXISTS (SELECT 1 FROM qnhd.user_role AS ur WHERE ur.uid = u.id AND ur.role_id = ?)`,
+			role.Id, role.Id).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setRolePermissions(tx *gorm.DB, roleId uint64, perms []PermissionType.Enum) error {
+	if err := tx.Where("role_id = ?", roleId).Delete(&RolePermission{}).Error; err != nil {
+		return err
+	}
+	if len(perms) == 0 {
+		return nil
+	}
+	var list []RolePermission
+	for _, p := range perms {
+		list = append(list, RolePermission{RoleId: roleId, Permission: p.GetSymbol()})
+	}
+	return tx.Create(&list).Error
+}
+
+// 根据user_role同步user表中的管理员标记
+func syncUserFlags(tx *gorm.DB, uid uint64) error {
+	var sets []string
+	for _, b := range builtinRoles {
+		sets = append(sets, fmt.Sprintf(`%s = EXISTS (SELECT 1 FROM qnhd.user_role AS ur
+			JOIN qnhd.role AS r ON r.id = ur.role_id WHERE ur.uid = @uid AND r.name = '%s')`, b.Column, b.Name))
+	}
+	return tx.Exec("UPDATE qnhd.user SET "+strings.Join(sets, ", ")+" WHERE id = @uid",
+		map[string]interface{}{"uid": uid}).Error
+}
+
+func userPermissionQuery(uid string, perm PermissionType.Enum) *gorm.DB {
+	return db.Table("qnhd.user_role AS ur").
+		Joins("JOIN qnhd.role_permission AS rp ON rp.role_id = ur.role_id").
+		Where("ur.uid = ? AND rp.permission = ?", uid, perm.GetSymbol())
+}
+
+// 用户在任意范围内拥有权限
+func HasPermission(uid string, perm PermissionType.Enum) bool {
+	var cnt int64
+	if err := userPermissionQuery(uid, perm).Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+// 用户在指定范围内拥有权限，范围为空时只匹配不限范围的角色
+func HasPermissionIn(uid string, perm PermissionType.Enum, scope Scope) bool {
+	var cnt int64
+	if err := userPermissionQuery(uid, perm).
+		Where("(ur.department_id = 0 OR ur.department_id = ?)", scope.DepartmentId).
+		Where("(ur.post_type = 0 OR ur.post_type = ?)", scope.PostType).
+		Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+// 用户拥有的所有权限
+func GetUserPermissions(uid string) ([]string, error) {
+	var list = []string{}
+	err := db.Table("qnhd.user_role AS ur").
+		Joins("JOIN qnhd.role_permission AS rp ON rp.role_id = ur.role_id").
+		Where("ur.uid = ?", uid).
+		Distinct("rp.permission").Order("rp.permission").
+		Pluck("rp.permission", &list).Error
+	return list, err
+}
+
+// 用户是否拥有全部给定权限
+func hasAllPermissions(uid string, perms []string) bool {
+	own, err := GetUserPermissions(uid)
+	if err != nil {
+		return false
+	}
+	set := map[string]bool{}
+	for _, p := range own {
+		set[p] = true
+	}
+	for _, p := range perms {
+		if !set[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// 操作者拥有目标账号的全部权限时才能管理该账号
+func CanManageUser(uid string, userId uint64) bool {
+	perms, err := GetUserPermissions(fmt.Sprint(userId))
+	if err != nil {
+		return false
+	}
+	return hasAllPermissions(uid, perms)
+}
+
+// 是否为不限范围的超级管理员
+func isSuperUser(uid string) bool {
+	var cnt int64
+	if err := db.Table("qnhd.user_role AS ur").
+		Joins("JOIN qnhd.role AS r ON r.id = ur.role_id").
+		Where("ur.uid = ? AND r.name = ? AND ur.department_id = 0 AND ur.post_type = 0", uid, ROLE_SUPER).
+		Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+// 非超级管理员不能修改自己拥有的角色和超级管理员角色，也不能修改权限超过自己的角色
+func canEditRole(uid string, role Role) bool {
+	if isSuperUser(uid) {
+		return true
+	}
+	if role.Name == ROLE_SUPER {
+		return false
+	}
+	var cnt int64
+	if err := db.Model(&UserRole{}).Where("uid = ? AND role_id = ?", uid, role.Id).Count(&cnt).Error; err != nil || cnt > 0 {
+		return false
+	}
+	return canGrantRole(uid, "r.id = ?", role.Id)
+}
+
+// 操作者拥有角色的全部权限时才能分配该角色
+func canGrantRole(uid string, query string, args ...interface{}) bool {
+	var perms []string
+	if err := db.Table("qnhd.role_permission AS rp").
+		Joins("JOIN qnhd.role AS r ON r.id = rp.role_id").
+		Where(query, args...).
+		Pluck("rp.permission", &perms).Error; err != nil {
+		return false
+	}
+	return hasAllPermissions(uid, perms)
+}
+
+func parsePermissions(symbols []string) ([]PermissionType.Enum, error) {
+	var perms []PermissionType.Enum
+	seen := map[PermissionType.Enum]bool{}
+	for _, s := range symbols {
+		p, ok := PermissionType.FromSymbol(s)
+		if !ok {
+			return nil, fmt.Errorf("未知权限: %s", s)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	return perms, nil
+}
+
+func GetRoles() ([]Role, error) {
+	var roles = []Role{}
+	if err := db.Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	var perms []RolePermission
+	if err := db.Order("permission").Find(&perms).Error; err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		roles[i].Permissions = []string{}
+		for _, p := range perms {
+			if p.RoleId == roles[i].Id {
+				roles[i].Permissions = append(roles[i].Permissions, p.Permission)
+			}
+		}
+	}
+	return roles, nil
+}
+
+func AddRole(uid string, maps map[string]interface{}) (uint64, error) {
+	perms, err := parsePermissions(maps["permissions"].([]string))
+	if err != nil {
+		return 0, err
+	}
+	if !hasAllPermissions(uid, maps["permissions"].([]string)) {
+		return 0, ErrPermissionExceeded
+	}
+	role := Role{
+		Name:        maps["name"].(string),
+		Description: maps["description"].(string),
+	}
+	var cnt int64
+	if err := db.Model(&Role{}).Where("name = ?", role.Name).Count(&cnt).Error; err != nil {
+		return 0, err
+	}
+	if cnt > 0 {
+		return 0, fmt.Errorf("角色已存在")
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&role).Error; err != nil {
+			return err
+		}
+		return setRolePermissions(tx, role.Id, perms)
+	})
+	if err != nil {
+		return 0, err
+	}
+	addManagerLogWithDetail(util.AsUint(uid), role.Id, ManagerLogType.ROLE_ADD, strings.Join(maps["permissions"].([]string), ","))
+	return role.Id, nil
+}
+
+// 修改角色的说明和权限，超级管理员不能修改
+func EditRole(uid string, id uint64, maps map[string]interface{}) error {
+	var role Role
+	if err := db.Where("id = ?", id).First(&role).Error; err != nil {
+		return err
+	}
+	if role.Name == ROLE_SUPER {
+		return ErrRoleBuiltin
+	}
+	perms, err := parsePermissions(maps["permissions"].([]string))
+	if err != nil {
+		return err
+	}
+	if !canEditRole(uid, role) || !hasAllPermissions(uid, maps["permissions"].([]string)) {
+		return ErrPermissionExceeded
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Role{}).Where("id = ?", id).Update("description", maps["description"]).Error; err != nil {
+			return err
+		}
+		return setRolePermissions(tx, id, perms)
+	})
+	if err != nil {
+		return err
+	}
+	return addManagerLogWithDetail(util.AsUint(uid), id, ManagerLogType.ROLE_EDIT, strings.Join(maps["permissions"].([]string), ","))
+}
+
+// 设置角色是否要求两步验证
+func EditRoleTotp(uid string, id uint64, require bool) error {
+	var role Role
+	if err := db.Where("id = ?", id).First(&role).Error; err != nil {
+		return err
+	}
+	if !canEditRole(uid, role) {
+		return ErrPermissionExceeded
+	}
+	if err := db.Model(&Role{}).Where("id = ?", id).Update("require_totp", require).Error; err != nil {
+		return err
+	}
+	return addManagerLogWithDetail(util.AsUint(uid), id, ManagerLogType.ROLE_EDIT, fmt.Sprintf("require_totp: %v", require))
+}
+
+// 删除角色，内置角色不能删除
+func DeleteRole(uid string, id uint64) error {
+	var role Role
+	if err := db.Where("id = ?", id).First(&role).Error; err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrRoleBuiltin
+	}
+	if !canEditRole(uid, role) {
+		return ErrPermissionExceeded
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", id).Delete(&RolePermission{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		return err
+	}
+	return addManagerLogWithDetail(util.AsUint(uid), id, ManagerLogType.ROLE_DELETE, role.Name)
+}
+
+func GetUserRoles(uid uint64) ([]UserRoleDetail, error) {
+	var list = []UserRoleDetail{}
+	err := db.Table("qnhd.user_role AS ur").
+		Select("ur.*", "r.name AS role_name").
+		Joins("JOIN qnhd.role AS r ON r.id = ur.role_id").
+		Where("ur.uid = ?", uid).
+		Order("ur.id").
+		Find(&list).Error
+	return list, err
+}
+
+// 给用户分配角色，可以限定部门和帖子类型
+func AddUserRole(uid string, maps map[string]interface{}) (uint64, error) {
+	ur := UserRole{
+		Uid:          maps["uid"].(uint64),
+		RoleId:       maps["role_id"].(uint64),
+		DepartmentId: maps["department_id"].(uint64),
+		PostType:     maps["post_type"].(int),
+	}
+	if _, err := GetUser(map[string]interface{}{"id": ur.Uid}); err != nil {
+		return 0, err
+	}
+	var role Role
+	if err := db.Where("id = ?", ur.RoleId).First(&role).Error; err != nil {
+		return 0, err
+	}
+	if !CanManageUser(uid, ur.Uid) || !canGrantRole(uid, "r.id = ?", ur.RoleId) {
+		return 0, ErrPermissionExceeded
+	}
+	if ur.DepartmentId > 0 {
+		if _, err := GetDepartment(ur.DepartmentId); err != nil {
+			return 0, err
+		}
+	}
+	if ur.PostType > 0 && !IsValidPostType(ur.PostType) {
+		return 0, fmt.Errorf("帖子类型不存在")
+	}
+	var cnt int64
+	if err := db.Model(&UserRole{}).Where(map[string]interface{}{
+		"uid":           ur.Uid,
+		"role_id":       ur.RoleId,
+		"department_id": ur.DepartmentId,
+		"post_type":     ur.PostType,
+	}).Count(&cnt).Error; err != nil {
+		return 0, err
+	}
+	if cnt > 0 {
+		return 0, fmt.Errorf("用户已有该角色")
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&ur).Error; err != nil {
+			return err
+		}
+		return syncUserFlags(tx, ur.Uid)
+	})
+	if err != nil {
+		return 0, err
+	}
+	addManagerLogWithDetail(util.AsUint(uid), ur.Uid, ManagerLogType.USER_ROLE_ADD,
+		fmt.Sprintf("role: %s, department_id: %d, post_type: %d", role.Name, ur.DepartmentId, ur.PostType))
+	return ur.Id, nil
+}
+
+// 移除用户的角色
+func DeleteUserRole(uid string, id uint64) error {
+	var ur UserRoleDetail
+	if err := db.Table("qnhd.user_role AS ur").
+		Select("ur.*", "r.name AS role_name").
+		Joins("JOIN qnhd.role AS r ON r.id = ur.role_id").
+		Where("ur.id = ?", id).
+		First(&ur).Error; err != nil {
+		return err
+	}
+	if !CanManageUser(uid, ur.Uid) {
+		return ErrPermissionExceeded
+	}
+	if err := deleteUserRoles(ur.Uid, "id = ?", id); err != nil {
+		return err
+	}
+	return addManagerLogWithDetail(util.AsUint(uid), ur.Uid, ManagerLogType.USER_ROLE_DELETE,
+		fmt.Sprintf("role: %s, department_id: %d, post_type: %d", ur.RoleName, ur.DepartmentId, ur.PostType))
+}
+
+// 删除用户的角色，不能删除最后一个超级管理员
+func deleteUserRoles(uid uint64, query string, args ...interface{}) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(query, args...).Delete(&UserRole{}).Error; err != nil {
+			return err
+		}
+		var cnt int64
+		if err := tx.Table("qnhd.user_role AS ur").
+			Joins("JOIN qnhd.role AS r ON r.id = ur.role_id").
+			Where("r.name = ? AND ur.department_id = 0 AND ur.post_type = 0", ROLE_SUPER).
+			Count(&cnt).Error; err != nil {
+			return err
+		}
+		if cnt == 0 {
+			return ErrLastSuperRole
+		}
+		return syncUserFlags(tx, uid)
+	})
+}
+
+// 设置用户的内置管理员角色
+func EditUserRight(uid string, userId uint64, schAdmin, stuAdmin bool) error {
+	if _, err := GetUser(map[string]interface{}{"id": userId}); err != nil {
+		return err
+	}
+	if !CanManageUser(uid, userId) {
+		return ErrPermissionExceeded
+	}
+	rights := []struct {
+		Name string
+		Has  bool
+	}{
+		{ROLE_SCH_ADMIN, schAdmin},
+		{ROLE_STU_ADMIN, stuAdmin},
+	}
+	for _, right := range rights {
+		if right.Has && !canGrantRole(uid, "r.name = ?", right.Name) {
+			return ErrPermissionExceeded
+		}
+	}
+	var detail []string
+	for _, right := range rights {
+		var role Role
+		if err := db.Where("name = ?", right.Name).First(&role).Error; err != nil {
+			return err
+		}
+		const global = "uid = ? AND role_id = ? AND department_id = 0 AND post_type = 0"
+		if !right.Has {
+			if err := deleteUserRoles(userId, global, userId, role.Id); err != nil {
+				return err
+			}
+		} else if err := db.Transaction(func(tx *gorm.DB) error {
+			var cnt int64
+			if err := tx.Model(&UserRole{}).Where(global, userId, role.Id).Count(&cnt).Error; err != nil {
+				return err
+			}
+			if cnt > 0 {
+				return nil
+			}
+			if err := tx.Create(&UserRole{Uid: userId, RoleId: role.Id}).Error; err != nil {
+				return err
+			}
+			return syncUserFlags(tx, userId)
+		}); err != nil {
+			return err
+		}
+		detail = append(detail, fmt.Sprintf("%s: %v", right.Name, right.Has))
+	}
+	return addManagerLogWithDetail(util.AsUint(uid), userId, ManagerLogType.USER_PERMISSION_CHANGE, strings.Join(detail, ", "))
+}
+
+type flagRole struct {
+	Name string
+	Has  bool
+}
+
+func userFlagRoles(user User) []flagRole {
+	return []flagRole{
+		{ROLE_SUPER, user.IsSuper},
+		{ROLE_SCH_ADMIN, user.IsSchAdmin},
+		{ROLE_STU_ADMIN, user.IsStuAdmin},
+		{ROLE_SCH_DISTRIBUTE_ADMIN, user.IsSchDistributeAdmin},
+	}
+}
+
+// 新建管理员时，标记对应的角色需要角色管理权限并且不超过操作者的权限
+func canGrantFlagRoles(uid string, user User) bool {
+	for _, flag := range userFlagRoles(user) {
+		if !flag.Has {
+			continue
+		}
+		if !HasPermission(uid, PermissionType.ROLE_MANAGE) || !canGrantRole(uid, "r.name = ?", flag.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// 给新建的管理员分配标记对应的角色
+func addFlagRoles(tx *gorm.DB, user User) error {
+	for _, flag := range userFlagRoles(user) {
+		if !flag.Has {
+			continue
+		}
+		var role Role
+		if err := tx.Where("name = ?", flag.Name).First(&role).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&UserRole{Uid: user.Uid, RoleId: role.Id}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -80,17 +80,14 @@ func FlushTagsTokens(all bool) error {
 	var tags []Tag
 	db.Find(&tags)
 	for _, p := range tags {
-		if all {
-			if err := db.Model(&Tag{}).Where("id = ?", p.Id).
-				Update("tokens", gorm.Expr(geneTokenString(p.Name))).Error; err != nil {
+		if all || p.Tokens == "" {
+			strs, err := tagTokenStrings(db, p)
+			if err != nil {
 				return err
 			}
-		} else {
-			if p.Tokens == "" {
-				if err := db.Model(&Tag{}).Where("id = ?", p.Id).
-					Update("tokens", gorm.Expr(geneTokenString(p.Name))).Error; err != nil {
-					return err
-				}
+			if err := db.Model(&Tag{}).Where("id = ?", p.Id).
+				Update("tokens", gorm.Expr(geneTokenString(strs...))).Error; err != nil {
+				return err
 			}
 		}
 		fmt.Println(p.Name, "更新成功")
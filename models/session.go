@@ -0,0 +1,234 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"qnhd/pkg/setting"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录会话，保存refresh token的hash
+type Session struct {
+	Id  string `json:"id" gorm:"primaryKey"`
+	Uid uint64 `json:"-"`
+	// 当前和上一个refresh token的hash，上一个被再次使用说明token泄露
+	RefreshHash     string     `json:"-"`
+	PrevRefreshHash string     `json:"-"`
+	UserAgent       string     `json:"user_agent"`
+	Ip              string     `json:"ip"`
+	CreatedAt       time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt      time.Time  `json:"last_used_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	RevokedAt       *time.Time `json:"-"`
+	// 最近一次完成两步验证的时间
+	TotpVerifiedAt *time.Time `json:"-"`
+	// 是否为当前请求的会话
+	Current bool `json:"current" gorm:"-"`
+}
+
+var (
+	ErrSessionRevoked = errors.New("登录已失效，请重新登录")
+)
+
+// 会话状态的缓存时间，注销在本实例立即生效，其他实例最多延迟该时间
+const sessionCacheTTL = 30 * time.Second
+
+type sessionCacheEntry struct {
+	active    bool
+	checkedAt time.Time
+}
+
+var sessionCache = struct {
+	sync.Mutex
+	m map[string]sessionCacheEntry
+}{m: map[string]sessionCacheEntry{}}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sessionExpireTime() time.Time {
+	return time.Now().Add(time.Duration(setting.AppSetting.TokenExpireTime) * time.Hour)
+}
+
+// 新建会话，返回会话和refresh token
+func CreateSession(uid uint64, userAgent, ip string) (*Session, string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	refresh := id + "." + secret
+	if len(userAgent) > 200 {
+		userAgent = userAgent[:200]
+	}
+	s := &Session{
+		Id:          id,
+		Uid:         uid,
+		RefreshHash: hashRefreshToken(refresh),
+		UserAgent:   userAgent,
+		Ip:          ip,
+		LastUsedAt:  time.Now(),
+		ExpiresAt:   sessionExpireTime(),
+	}
+	if err := db.Create(s).Error; err != nil {
+		return nil, "", err
+	}
+	return s, refresh, nil
+}
+
+// 使用refresh token换取新的refresh token，旧的立即失效
+func RefreshSession(refresh string) (*Session, string, error) {
+	parts := strings.SplitN(refresh, ".", 2)
+	if len(parts) != 2 {
+		return nil, "", ErrSessionRevoked
+	}
+	var s Session
+	if err := db.Where("id = ?", parts[0]).First(&s).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", ErrSessionRevoked
+		}
+		return nil, "", err
+	}
+	if s.RevokedAt != nil || time.Now().After(s.ExpiresAt) {
+		return nil, "", ErrSessionRevoked
+	}
+	hash := hashRefreshToken(refresh)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(s.RefreshHash)) != 1 {
+		// 已经轮换过的token被再次使用，注销整个会话
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(s.PrevRefreshHash)) == 1 {
+			revokeSessions("id = ?", s.Id)
+		}
+		return nil, "", ErrSessionRevoked
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", err
+	}
+	newRefresh := s.Id + "." + secret
+	// 带上旧hash作为条件，避免并发刷新时两个请求都成功
+	res := db.Model(&Session{}).Where("id = ? AND refresh_hash = ?", s.Id, s.RefreshHash).Updates(map[string]interface{}{
+		"refresh_hash":      hashRefreshToken(newRefresh),
+		"prev_refresh_hash": s.RefreshHash,
+		"last_used_at":      time.Now(),
+		"expires_at":        sessionExpireTime(),
+	})
+	if res.Error != nil {
+		return nil, "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, "", ErrSessionRevoked
+	}
+	return &s, newRefresh, nil
+}
+
+// 用户未注销的会话
+func GetUserSessions(uid uint64, currentSid string) ([]Session, error) {
+	var list = []Session{}
+	err := db.Where("uid = ? AND revoked_at IS NULL AND expires_at > ?", uid, time.Now()).
+		Order("last_used_at DESC").Find(&list).Error
+	for i := range list {
+		list[i].Current = list[i].Id == currentSid
+	}
+	return list, err
+}
+
+// 注销用户的某个会话
+func RevokeSession(uid uint64, sid string) error {
+	res := revokeSessions("uid = ? AND id = ?", uid, sid)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("会话不存在")
+	}
+	return nil
+}
+
+// 注销用户的全部会话，可以保留一个
+func RevokeUserSessions(uid uint64, exceptSid string) error {
+	return revokeSessions("uid = ? AND id <> ?", uid, exceptSid).Error
+}
+
+func revokeSessions(query string, args ...interface{}) *gorm.DB {
+	var ids []string
+	db.Model(&Session{}).Where(query, args...).Where("revoked_at IS NULL").Pluck("id", &ids)
+	res := db.Model(&Session{}).Where(query, args...).Where("revoked_at IS NULL").Update("revoked_at", time.Now())
+	sessionCache.Lock()
+	for _, id := range ids {
+		sessionCache.m[id] = sessionCacheEntry{false, time.Now()}
+	}
+	sessionCache.Unlock()
+	return res
+}
+
+// 会话是否有效，带缓存
+func IsSessionActive(sid string) bool {
+	if sid == "" {
+		return false
+	}
+	now := time.Now()
+	sessionCache.Lock()
+	e, ok := sessionCache.m[sid]
+	sessionCache.Unlock()
+	if ok && now.Sub(e.checkedAt) < sessionCacheTTL {
+		return e.active
+	}
+	var cnt int64
+	if err := db.Model(&Session{}).Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sid, now).Count(&cnt).Error; err != nil {
+		// 数据库错误时沿用之前的结果
+		return ok && e.active
+	}
+	sessionCache.Lock()
+	sessionCache.m[sid] = sessionCacheEntry{cnt > 0, now}
+	sessionCache.Unlock()
+	return cnt > 0
+}
+
+// 记录会话完成了两步验证
+func MarkSessionTotp(sid string) error {
+	return db.Model(&Session{}).Where("id = ?", sid).Update("totp_verified_at", time.Now()).Error
+}
+
+// 会话最近是否完成过两步验证
+func IsSessionTotpRecent(sid string) bool {
+	var cnt int64
+	from := time.Now().Add(-time.Duration(setting.TotpSetting.RecentMinutes) * time.Minute)
+	if err := db.Model(&Session{}).Where("id = ? AND totp_verified_at >= ?", sid, from).Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+// 清理过期和已注销的会话
+func FlushSessions() (int64, error) {
+	sessionCache.Lock()
+	for id, e := range sessionCache.m {
+		if time.Since(e.checkedAt) > sessionCacheTTL {
+			delete(sessionCache.m, id)
+		}
+	}
+	sessionCache.Unlock()
+	res := db.Where("expires_at < ? OR revoked_at < ?", time.Now(), daysAgo(7)).Delete(&Session{})
+	return res.RowsAffected, res.Error
+}
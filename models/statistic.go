@@ -14,6 +14,12 @@ func GetFloorCount(from, to string) (int64, error) {
 
 func GetVisitPostCount(from, to string) (int64, error) {
 	var cnt int64
-	err := db.Model(&LogVisitHistory{}).Where("created_at > ? AND created_at < ?", from, to).Count(&cnt).Error
-	return cnt, err
+	if err := db.Model(&LogVisitHistory{}).Where("created_at > ? AND created_at < ?", from, to).Count(&cnt).Error; err != nil {
+		return cnt, err
+	}
+	// 已聚合的部分按天计算
+	var daily int64
+	err := db.Model(&LogVisitDaily{}).Select("COALESCE(SUM(count), 0)").
+		Where("date >= ?::date AND date <= ?::date", from, to).Find(&daily).Error
+	return cnt + daily, err
 }
@@ -20,18 +20,24 @@ type Tag struct {
 	Uid    uint64 `json:"-"`
 	Name   string `json:"name"`
 	Tokens string `json:"-"`
+	// 关注人数
+	FollowerCount uint64 `json:"follower_count" gorm:"default:0"`
 }
 
 type LogTag struct {
-	TagId     uint64            `json:"tag_id"`
-	Point     TagPointType.Enum `json:"point"`
-	CreatedAt string            `json:"created_at" gorm:"default:null;"`
+	TagId uint64 `json:"tag_id"`
+	// 操作类型，计算热度时使用当前配置的权重
+	Action string `json:"action" gorm:"default:''"`
+	// 记录时的热度
+	Point     int64  `json:"point"`
+	CreatedAt string `json:"created_at" gorm:"default:null;"`
 }
 
 type HotTagResult struct {
-	TagId int    `json:"tag_id"`
-	Point int    `json:"point"`
-	Name  string `json:"name"`
+	TagId         int    `json:"tag_id"`
+	Point         int    `json:"point"`
+	Name          string `json:"name"`
+	FollowerCount int    `json:"follower_count"`
 }
 
 func ExistTagByName(name string) (bool, error) {
@@ -77,6 +83,7 @@ func GetRecommendTag(lastId int) (HotTagResult, error) {
 		tag.TagId = int(t.Id)
 		tag.Point = 0
 		tag.Name = t.Name
+		tag.FollowerCount = int(t.FollowerCount)
 		return tag, nil
 	}
 	rand.Seed(time.Now().UnixNano())
@@ -87,16 +94,15 @@ func GetRecommendTag(lastId int) (HotTagResult, error) {
 	return tags[idx], nil
 }
 
-// 获取24小时内高赞tag
+// 获取热度最高的tag，热度定时计算
 func GetHotTags(cnt int) ([]HotTagResult, error) {
 	var results []HotTagResult
-	logs := db.Model(&LogTag{}).Where("created_at > CURRENT_TIMESTAMP + '-1 day'")
-	if err := db.Table("(?) as a", logs).
+	if err := db.Model(&TagScore{}).
 		Joins("JOIN qnhd.tag ON qnhd.tag.id = tag_id").
-		Select("tag_id", "sum(point) as point", "name").
-		Group("tag_id, name").
+		Select("tag_id", "ROUND(score) as point", "name", "follower_count").
+		Where("score > 0").
 		Limit(cnt).
-		Order("point desc").
+		Order("score desc").
 		Find(&results).Error; err != nil {
 		return nil, err
 	}
@@ -104,7 +110,16 @@ func GetHotTags(cnt int) ([]HotTagResult, error) {
 }
 
 func AddTag(name, uid string) (uint64, error) {
-	var tag = Tag{Name: filter.CommonFilter.Filter(name), Uid: util.AsUint(uid)}
+	name = filter.CommonFilter.Filter(name)
+	// 别名直接返回合并后的tag
+	var alias TagAlias
+	if err := db.Where("name = ?", name).Find(&alias).Error; err != nil {
+		return 0, err
+	}
+	if alias.TagId > 0 {
+		return alias.TagId, nil
+	}
+	var tag = Tag{Name: name, Uid: util.AsUint(uid)}
 	if err := db.Select("name", "uid").Create(&tag).Error; err != nil {
 		return 0, err
 	}
@@ -150,25 +165,40 @@ func deleteTag(id uint64) error {
 		if err := tx.Where("tag_id = ?", id).Delete(&LogTag{}).Error; err != nil {
 			return err
 		}
+		// 删除别名
+		if err := tx.Where("tag_id = ?", id).Delete(&TagAlias{}).Error; err != nil {
+			return err
+		}
+		// 删除关注
+		if err := tx.Where("tag_id = ?", id).Delete(&TagFollow{}).Error; err != nil {
+			return err
+		}
+		// 删除热度
+		if err := tx.Where("tag_id = ?", id).Delete(&TagScore{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", id).Delete(&TagScoreDaily{}).Error; err != nil {
+			return err
+		}
 		// 删除tag
 		return tx.Where("id = ?", id).Delete(&Tag{}).Error
 	})
 }
 
 func addTagLogInPost(postId uint64, point TagPointType.Enum) error {
-	var pt PostTag
-	if err := db.Where("post_id = ?", postId).Find(&pt).Error; err != nil {
+	ids, err := getTagIdsInPost(db, postId)
+	if err != nil {
 		return err
 	}
-	if pt.TagId != 0 {
-		addTagLog(pt.TagId, point)
+	for _, id := range ids {
+		addTagLog(id, point)
 	}
 	return nil
 }
 
 // 增加Tag访问记录
-func addTagLog(id uint64, point TagPointType.Enum) {
-	var log = LogTag{TagId: id, Point: point}
+func addTagLog(id uint64, action TagPointType.Enum) {
+	var log = LogTag{TagId: id, Action: action.GetSymbol(), Point: int64(tagPointWeight(tagHotConfig(), action))}
 	if err := db.Create(&log).Error; err != nil {
 		logging.Error("add tag log error: %v", log)
 	}
@@ -176,13 +206,19 @@ func addTagLog(id uint64, point TagPointType.Enum) {
 
 // 给tag加热度
 func AddTagLog(uid string, id uint64, point int64) error {
-	var log = LogTag{TagId: id, Point: TagPointType.Enum(point)}
+	var log = LogTag{TagId: id, Action: TagPointType.MANUAL.GetSymbol(), Point: point}
 	addManagerLogWithDetail(util.AsUint(uid), id, ManagerLogType.TAG_POINT_ADD, fmt.Sprintf("add: %d", point))
-	return db.Create(&log).Error
+	if err := db.Create(&log).Error; err != nil {
+		return err
+	}
+	return FlushTagScores()
 }
 
 // 清空tag热度
 func ClearTagLog(uid string, id uint64) error {
 	addManagerLog(util.AsUint(uid), id, ManagerLogType.TAG_POINT_CLEAR)
-	return db.Where("tag_id = ?", id).Delete(&LogTag{}).Error
+	if err := db.Where("tag_id = ?", id).Delete(&LogTag{}).Error; err != nil {
+		return err
+	}
+	return FlushTagScores()
 }
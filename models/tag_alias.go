@@ -0,0 +1,127 @@
+package models
+
+import (
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/pkg/util"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// 合并后保留的旧tag名
+type TagAlias struct {
+	Name      string `json:"name" gorm:"primaryKey"`
+	TagId     uint64 `json:"tag_id"`
+	CreatedAt string `json:"created_at" gorm:"autoCreateTime;default:null;"`
+}
+
+func GetTagAliases(tagId uint64) ([]string, error) {
+	var names = []string{}
+	err := db.Model(&TagAlias{}).Select("name").Where("tag_id = ?", tagId).Order("created_at").Find(&names).Error
+	return names, err
+}
+
+// tag的分词内容包括别名，搜索别名时可以找到合并后的tag
+func tagTokenStrings(tx *gorm.DB, tag Tag) ([]string, error) {
+	var names []string
+	if err := tx.Model(&TagAlias{}).Select("name").Where("tag_id = ?", tag.Id).Find(&names).Error; err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return []string{tag.Name}, nil
+	}
+	// 别名权重低于原名
+	return []string{tag.Name, strings.Join(names, " ")}, nil
+}
+
+// 将多个tag合并到目标tag
+func MergeTags(uid string, targetId uint64, sourceIds []uint64) error {
+	var (
+		target  Tag
+		sources []Tag
+	)
+	sourceIds = util.SetUint64(sourceIds)
+	for _, id := range sourceIds {
+		if id == targetId {
+			return fmt.Errorf("不能合并到自身")
+		}
+	}
+	if err := db.Where("id = ?", targetId).First(&target).Error; err != nil {
+		return err
+	}
+	if err := db.Where("id IN (?)", sourceIds).Find(&sources).Error; err != nil {
+		return err
+	}
+	if len(sources) != len(sourceIds) {
+		return fmt.Errorf("tag不存在")
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// 帖子关联到目标tag，已有目标tag的帖子不重复添加
+		if err := tx.Exec(`INSERT INTO qnhd.post_tag (post_id, tag_id)
+			SELECT DISTINCT post_id, ? FROM qnhd.post_tag WHERE tag_id IN (?)
+			AND post_id NOT IN (SELECT post_id FROM qnhd.post_tag WHERE tag_id = ?)`,
+			targetId, sourceIds, targetId).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id IN (?)", sourceIds).Delete(&PostTag{}).Error; err != nil {
+			return err
+		}
+		// 热度记录转移
+		if err := tx.Model(&LogTag{}).Where("tag_id IN (?)", sourceIds).Update("tag_id", targetId).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&TagScoreDaily{}).Where("tag_id IN (?)", sourceIds).Update("tag_id", targetId).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id IN (?)", sourceIds).Delete(&TagScore{}).Error; err != nil {
+			return err
+		}
+		// 关注转移，已关注目标tag的用户不重复关注
+		if err := tx.Where("tag_id IN (?) AND uid IN (?)", sourceIds,
+			tx.Model(&TagFollow{}).Select("uid").Where("tag_id = ?", targetId)).Delete(&TagFollow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE qnhd.tag_follow SET tag_id = ? WHERE ctid IN (
+			SELECT DISTINCT ON (uid) ctid FROM qnhd.tag_follow WHERE tag_id IN (?) ORDER BY uid, notify DESC)`,
+			targetId, sourceIds).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id IN (?)", sourceIds).Delete(&TagFollow{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Tag{}).Where("id = ?", targetId).Update("follower_count",
+			tx.Model(&TagFollow{}).Select("COUNT(*)").Where("tag_id = ?", targetId)).Error; err != nil {
+			return err
+		}
+		// 原来的别名也转移
+		if err := tx.Model(&TagAlias{}).Where("tag_id IN (?)", sourceIds).Update("tag_id", targetId).Error; err != nil {
+			return err
+		}
+		var aliases []TagAlias
+		for _, s := range sources {
+			aliases = append(aliases, TagAlias{Name: s.Name, TagId: targetId})
+		}
+		if err := tx.Create(&aliases).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN (?)", sourceIds).Delete(&Tag{}).Error; err != nil {
+			return err
+		}
+		strs, err := tagTokenStrings(tx, target)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&Tag{}).Where("id = ?", targetId).Update("tokens", gorm.Expr(geneTokenString(strs...))).Error
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, s := range sources {
+		names = append(names, fmt.Sprintf("%s(%d)", s.Name, s.Id))
+	}
+	addManagerLogWithDetail(util.AsUint(uid), targetId, ManagerLogType.TAG_MERGE,
+		fmt.Sprintf("merge: %s into: %s", strings.Join(names, ", "), target.Name))
+	return nil
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"qnhd/enums/NoticeType"
+	"qnhd/enums/NotificationEventType"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/util"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TagFollow struct {
+	Uid   uint64 `json:"-" gorm:"primaryKey"`
+	TagId uint64 `json:"tag_id" gorm:"primaryKey"`
+	// 是否接收新帖通知，默认关闭
+	Notify    bool   `json:"notify" gorm:"default:false"`
+	CreatedAt string `json:"created_at" gorm:"autoCreateTime;default:null;"`
+}
+
+type TagFollowResponse struct {
+	Tag
+	Notify bool `json:"notify"`
+}
+
+func GetFollowedTags(uid uint64) ([]TagFollowResponse, error) {
+	var list = []TagFollowResponse{}
+	err := db.Model(&TagFollow{}).
+		Select("qnhd.tag.*", "qnhd.tag_follow.notify").
+		Joins("JOIN qnhd.tag ON qnhd.tag.id = qnhd.tag_follow.tag_id").
+		Where("qnhd.tag_follow.uid = ?", uid).
+		Order("qnhd.tag_follow.created_at DESC").
+		Find(&list).Error
+	return list, err
+}
+
+func FollowTag(uid, tagId uint64, notify bool) error {
+	var tag Tag
+	if err := db.Where("id = ?", tagId).First(&tag).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var f TagFollow
+		err := tx.Where("uid = ? AND tag_id = ?", uid, tagId).First(&f).Error
+		if err == nil {
+			// 已关注时只修改通知设置
+			return tx.Model(&TagFollow{}).Where("uid = ? AND tag_id = ?", uid, tagId).Update("notify", notify).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err := tx.Create(&TagFollow{Uid: uid, TagId: tagId, Notify: notify}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Tag{}).Where("id = ?", tagId).Update("follower_count", gorm.Expr("follower_count + 1")).Error
+	})
+}
+
+func UnfollowTag(uid, tagId uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Where("uid = ? AND tag_id = ?", uid, tagId).Delete(&TagFollow{})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&Tag{}).Where("id = ? AND follower_count > 0", tagId).Update("follower_count", gorm.Expr("follower_count - 1")).Error
+	})
+}
+
+// 关注的tag下的帖子
+func GetFollowingPostResponses(c *gin.Context, uid string) ([]PostResponseUser, error) {
+	var posts []Post
+	tagIds := db.Model(&TagFollow{}).Select("tag_id").Where("uid = ?", uid)
+	postIds := db.Model(&PostTag{}).Select("post_id").Where("tag_id IN (?)", tagIds)
+	if err := db.Where("id IN (?)", postIds).Scopes(util.Paginate(c)).Order("id DESC").Find(&posts).Error; err != nil {
+		return nil, err
+	}
+	return transPostsToResponsesWithUid(&posts, uid)
+}
+
+// 通知关注了tag并开启通知的用户，每人只通知一次
+func notifyTagFollowers(post Post, tagIds []uint64) {
+	if len(tagIds) == 0 {
+		return
+	}
+	var follows []TagFollow
+	if err := db.Where("tag_id IN (?) AND notify = true AND uid <> ?", tagIds, post.Uid).Order("tag_id").Find(&follows).Error; err != nil {
+		logging.Error("notify tag followers error: %v", err)
+		return
+	}
+	var (
+		notified = map[uint64]bool{}
+		groups   = map[uint64][]uint64{}
+	)
+	for _, f := range follows {
+		if !notified[f.Uid] {
+			notified[f.Uid] = true
+			groups[f.TagId] = append(groups[f.TagId], f.Uid)
+		}
+	}
+	for tagId, uids := range groups {
+		uids = filterNotifyUids(uids, NotificationEventType.FOLLOWED_TAG_POST, NOTIFY_IN_APP, 0)
+		if len(uids) == 0 {
+			continue
+		}
+		var tag Tag
+		db.Where("id = ?", tagId).Find(&tag)
+		addNoticeWithTemplate(NoticeType.FOLLOWED_TAG_NEW_POST, uids, []string{tag.Name, post.Title})
+	}
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/enums/TagPointType"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/util"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 后台修改后的热度参数，只有一行
+type TagHotConfig struct {
+	Id uint64 `json:"-" gorm:"primaryKey"`
+	setting.TagHot
+	UpdatedAt string `json:"updated_at" gorm:"autoUpdateTime;default:null;"`
+}
+
+// tag当前的热度
+type TagScore struct {
+	TagId     uint64  `json:"tag_id" gorm:"primaryKey"`
+	Score     float64 `json:"score"`
+	UpdatedAt string  `json:"updated_at" gorm:"default:null;"`
+}
+
+// tag每日的热度，不衰减
+type TagScoreDaily struct {
+	TagId uint64  `json:"tag_id"`
+	Date  string  `json:"date"`
+	Score float64 `json:"score"`
+}
+
+const TAG_HOT_CONFIG_ID = 1
+
+var tagScoreLock sync.Mutex
+
+// 后台修改热度参数时与定时任务和请求并发
+var tagHotLock sync.RWMutex
+
+// 当前的热度参数
+func tagHotConfig() setting.TagHot {
+	tagHotLock.RLock()
+	defer tagHotLock.RUnlock()
+	return *setting.TagHotSetting
+}
+
+func setTagHotConfig(cfg setting.TagHot) {
+	tagHotLock.Lock()
+	defer tagHotLock.Unlock()
+	*setting.TagHotSetting = cfg
+}
+
+// 读取后台保存的热度参数，没有时使用配置文件
+func LoadTagHotConfig() error {
+	var cfg TagHotConfig
+	if err := db.Where("id = ?", TAG_HOT_CONFIG_ID).Find(&cfg).Error; err != nil {
+		return err
+	}
+	if cfg.Id > 0 {
+		setTagHotConfig(cfg.TagHot)
+	}
+	return nil
+}
+
+func GetTagHotConfig() setting.TagHot {
+	return tagHotConfig()
+}
+
+func EditTagHotConfig(uid string, cfg setting.TagHot) error {
+	if cfg.HalfLifeHours <= 0 {
+		return fmt.Errorf("半衰期必须大于0")
+	}
+	if cfg.WindowDays <= 0 {
+		return fmt.Errorf("计算天数必须大于0")
+	}
+	if err := db.Save(&TagHotConfig{Id: TAG_HOT_CONFIG_ID, TagHot: cfg}).Error; err != nil {
+		return err
+	}
+	setTagHotConfig(cfg)
+	detail, _ := json.Marshal(cfg)
+	addManagerLogWithDetail(util.AsUint(uid), TAG_HOT_CONFIG_ID, ManagerLogType.TAG_HOT_CONFIG_EDIT, string(detail))
+	return FlushTagScores()
+}
+
+// 当前配置下每种操作的热度
+func tagPointWeight(h setting.TagHot, t TagPointType.Enum) float64 {
+	base, undo := t.Undo()
+	var w float64
+	switch base {
+	case TagPointType.ADD_POST:
+		w = h.AddPost
+	case TagPointType.ADD_FLOOR:
+		w = h.AddFloor
+	case TagPointType.LIKE_POST:
+		w = h.LikePost
+	case TagPointType.FAV_POST:
+		w = h.FavPost
+	case TagPointType.DIS_POST:
+		w = h.DisPost
+	case TagPointType.LIKE_FLOOR:
+		w = h.LikeFloor
+	case TagPointType.DIS_FLOOR:
+		w = h.DisFloor
+	}
+	if undo {
+		return -w
+	}
+	return w
+}
+
+// 按记录的操作使用当前权重，手动增加和旧记录使用记录的point
+func tagWeightSql(h setting.TagHot) string {
+	var cases []string
+	for t := TagPointType.ADD_POST; t < TagPointType.MANUAL; t++ {
+		cases = append(cases, fmt.Sprintf("WHEN '%s' THEN %g", t.GetSymbol(), tagPointWeight(h, t)))
+	}
+	return fmt.Sprintf("(CASE action %s ELSE point END)", strings.Join(cases, " "))
+}
+
+// 重新计算所有tag的衰减热度
+func FlushTagScores() error {
+	tagScoreLock.Lock()
+	defer tagScoreLock.Unlock()
+	h := tagHotConfig()
+	args := map[string]interface{}{
+		"from":     daysAgo(h.WindowDays),
+		"half":     h.HalfLifeHours,
+		"follower": h.Follower,
+	}
+	scores := `SELECT tag_id, SUM(` + tagWeightSql(h) + ` *
+		EXP(-LN(2) * EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - created_at)) / 3600 / @half)) AS score
+		FROM qnhd.log_tag WHERE created_at >= @from GROUP BY tag_id`
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM qnhd.tag_score").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO qnhd.tag_score (tag_id, score, updated_at)
+			SELECT t.id, COALESCE(l.score, 0) + t.follower_count * @follower, CURRENT_TIMESTAMP
+			FROM qnhd.tag AS t LEFT JOIN (`+scores+`) AS l ON l.tag_id = t.id
+			WHERE l.score IS NOT NULL OR t.follower_count > 0`, args).Error
+	})
+}
+
+// 把之前每天的热度汇总到每日热度，从上次汇总的后一天到昨天
+func FlushTagScoreDaily() error {
+	tagScoreLock.Lock()
+	defer tagScoreLock.Unlock()
+	var last TagScoreDaily
+	if err := db.Order("date DESC").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, today.Location())
+	var from time.Time
+	if last.Date != "" {
+		t, err := time.ParseInLocation("2006-01-02", last.Date[:10], today.Location())
+		if err != nil {
+			return err
+		}
+		from = t.AddDate(0, 0, 1)
+	} else {
+		var first LogTag
+		if err := db.Order("created_at").Limit(1).Find(&first).Error; err != nil {
+			return err
+		}
+		if first.CreatedAt == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, first.CreatedAt)
+		if err != nil {
+			return err
+		}
+		from = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, today.Location())
+	}
+	weight := tagWeightSql(tagHotConfig())
+	// 中途失败时整体回滚，下次从同一天重新汇总
+	return db.Transaction(func(tx *gorm.DB) error {
+		for d := from; d.Before(today); d = d.AddDate(0, 0, 1) {
+			if err := tx.Exec(`INSERT INTO qnhd.tag_score_daily (tag_id, date, score)
+				SELECT tag_id, ?, SUM(`+weight+`) FROM qnhd.log_tag
+				WHERE created_at >= ? AND created_at < ? GROUP BY tag_id`,
+				d.Format("2006-01-02"), d, d.AddDate(0, 0, 1)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 获取tag最近几天的每日热度
+func GetTagScoreHistory(tagId uint64, days int) ([]TagScoreDaily, error) {
+	var list = []TagScoreDaily{}
+	// 合并过的tag同一天可能有多条
+	err := db.Model(&TagScoreDaily{}).Select("tag_id", "date", "SUM(score) as score").
+		Where("tag_id = ? AND date >= ?", tagId, daysAgo(days).Format("2006-01-02")).
+		Group("tag_id, date").Order("date").Find(&list).Error
+	return list, err
+}
@@ -0,0 +1,262 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	ManagerLogType "qnhd/enums/MangerLogType"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/totp"
+	"qnhd/pkg/util"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 后台账号的两步验证密钥
+type UserTotp struct {
+	Uid     uint64 `json:"-" gorm:"primaryKey"`
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled" gorm:"default:false"`
+	// 最后一次使用的时间步，同一个验证码不能使用两次
+	LastStep  int64      `json:"-" gorm:"default:0"`
+	EnabledAt *time.Time `json:"enabled_at"`
+	CreatedAt string     `json:"-" gorm:"autoCreateTime;default:null;"`
+}
+
+// 丢失验证器时使用的恢复码，只保存hash
+type TotpRecoveryCode struct {
+	Id       uint64     `json:"-" gorm:"primaryKey;autoIncrement;"`
+	Uid      uint64     `json:"-"`
+	CodeHash string     `json:"-"`
+	UsedAt   *time.Time `json:"-"`
+}
+
+var (
+	ErrTotpRequired = errors.New("需要两步验证")
+	ErrTotpInvalid  = errors.New("两步验证码错误")
+)
+
+// 恢复码使用的字符，去掉了容易混淆的字符
+const recoveryCodeChars = "abcdefghjkmnpqrstuvwxyz23456789"
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(normalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成新的恢复码，旧的全部失效
+func newRecoveryCodes(tx *gorm.DB, uid uint64) ([]string, error) {
+	if err := tx.Where("uid = ?", uid).Delete(&TotpRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	var (
+		codes []string
+		list  []TotpRecoveryCode
+	)
+	for i := 0; i < setting.TotpSetting.RecoveryCodes; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = recoveryCodeChars[int(b[j])%len(recoveryCodeChars)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		list = append(list, TotpRecoveryCode{Uid: uid, CodeHash: hashRecoveryCode(code)})
+	}
+	if len(list) > 0 {
+		if err := tx.Create(&list).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func getUserTotp(uid uint64) (UserTotp, error) {
+	var t UserTotp
+	err := db.Where("uid = ?", uid).Find(&t).Error
+	return t, err
+}
+
+// 是否开启了两步验证
+func IsTotpEnabled(uid uint64) bool {
+	t, err := getUserTotp(uid)
+	return err == nil && t.Enabled
+}
+
+// 用户的角色是否要求两步验证
+func IsTotpRequired(uid uint64) bool {
+	var cnt int64
+	if err := db.Table("qnhd.user_role AS ur").
+		Joins("JOIN qnhd.role AS r ON r.id = ur.role_id").
+		Where("ur.uid = ? AND r.require_totp = true", uid).
+		Count(&cnt).Error; err != nil {
+		return false
+	}
+	return cnt > 0
+}
+
+func GetTotpStatus(uid uint64) (map[string]interface{}, error) {
+	t, err := getUserTotp(uid)
+	if err != nil {
+		return nil, err
+	}
+	var left int64
+	if err := db.Model(&TotpRecoveryCode{}).Where("uid = ? AND used_at IS NULL", uid).Count(&left).Error; err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"enabled":        t.Enabled,
+		"enabled_at":     t.EnabledAt,
+		"required":       IsTotpRequired(uid),
+		"recovery_codes": left,
+	}, nil
+}
+
+// 生成新的密钥，验证一次验证码后才开启
+func SetupTotp(uid uint64) (string, string, error) {
+	user, err := GetUser(map[string]interface{}{"id": uid})
+	if err != nil {
+		return "", "", err
+	}
+	t, err := getUserTotp(uid)
+	if err != nil {
+		return "", "", err
+	}
+	if t.Enabled {
+		return "", "", fmt.Errorf("已开启两步验证")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := db.Save(&UserTotp{Uid: uid, Secret: secret}).Error; err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(setting.TotpSetting.Issuer, user.Nickname, secret), nil
+}
+
+// 校验验证码后开启两步验证，返回恢复码
+func EnableTotp(uid uint64, code string) ([]string, error) {
+	t, err := getUserTotp(uid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Uid == 0 {
+		return nil, fmt.Errorf("请先获取密钥")
+	}
+	if t.Enabled {
+		return nil, fmt.Errorf("已开启两步验证")
+	}
+	step, ok := totp.Validate(t.Secret, code, time.Now())
+	if !ok {
+		return nil, ErrTotpInvalid
+	}
+	var codes []string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&UserTotp{}).Where("uid = ?", uid).Updates(map[string]interface{}{
+			"enabled":    true,
+			"last_step":  step,
+			"enabled_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		codes, err = newRecoveryCodes(tx, uid)
+		return err
+	})
+	return codes, err
+}
+
+// 校验验证码或恢复码，失败计入密码错误次数
+func VerifyTotp(uid uint64, code string) error {
+	var user User
+	if err := db.Where("id = ?", uid).First(&user).Error; err != nil {
+		return err
+	}
+	if user.PasswordLockedUntil != nil && time.Now().Before(*user.PasswordLockedUntil) {
+		return fmt.Errorf("%w，请%d分钟后再试", ErrPasswordLocked, int(time.Until(*user.PasswordLockedUntil).Minutes())+1)
+	}
+	t, err := getUserTotp(uid)
+	if err != nil {
+		return err
+	}
+	if !t.Enabled {
+		return fmt.Errorf("未开启两步验证")
+	}
+	ok := false
+	if step, valid := totp.Validate(t.Secret, code, time.Now()); valid {
+		// 只接受比上次更新的时间步
+		res := db.Model(&UserTotp{}).Where("uid = ? AND last_step < ?", uid, step).Update("last_step", step)
+		if res.Error != nil {
+			return res.Error
+		}
+		ok = res.RowsAffected > 0
+	} else if code = normalizeRecoveryCode(code); len(code) == 10 {
+		res := db.Model(&TotpRecoveryCode{}).Where("uid = ? AND code_hash = ? AND used_at IS NULL", uid, hashRecoveryCode(code)).
+			Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		ok = res.RowsAffected > 0
+	}
+	if !ok {
+		addPasswordFailure(&user)
+		return ErrTotpInvalid
+	}
+	if user.PasswordFailedCount > 0 {
+		if err := db.Model(&User{}).Where("id = ?", uid).Update("password_failed_count", 0).Error; err != nil {
+			logging.Error("reset password failure error: %v", err)
+		}
+	}
+	return nil
+}
+
+// 关闭两步验证，调用前需要校验验证码
+func DisableTotp(uid uint64) error {
+	if IsTotpRequired(uid) {
+		return fmt.Errorf("当前角色要求开启两步验证")
+	}
+	return deleteUserTotp(uid)
+}
+
+// 重新生成恢复码，调用前需要校验验证码
+func RegenerateRecoveryCodes(uid uint64) ([]string, error) {
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) (err error) {
+		codes, err = newRecoveryCodes(tx, uid)
+		return
+	})
+	return codes, err
+}
+
+// 超管为丢失验证器的用户重置两步验证
+func ResetUserTotp(uid string, userId uint64) error {
+	if err := deleteUserTotp(userId); err != nil {
+		return err
+	}
+	// 已登录的会话也需要重新登录
+	if err := RevokeUserSessions(userId, ""); err != nil {
+		return err
+	}
+	return addManagerLog(util.AsUint(uid), userId, ManagerLogType.USER_TOTP_RESET)
+}
+
+func deleteUserTotp(uid uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("uid = ?", uid).Delete(&TotpRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("uid = ?", uid).Delete(&UserTotp{}).Error
+	})
+}
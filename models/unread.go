@@ -1,5 +1,11 @@
 package models
 
+import (
+	"qnhd/pkg/util"
+
+	"gorm.io/gorm"
+)
+
 type MessageCount struct {
 	Like   int `json:"like"`
 	Floor  int `json:"floor"`
@@ -13,7 +19,7 @@ func GetMessageCount(uid string) (MessageCount, error) {
 	// 楼层未读 回复未读 通知未读
 	var lcnt, fcnt, rcnt, ncnt int64
 	// 获取点赞未读数
-	if err := db.Model(&LogUnreadLike{}).Where("uid = ?", uid).Count(&lcnt).Error; err != nil {
+	if err := db.Model(&LogUnreadLike{}).Where("uid = ? AND is_read = false", uid).Count(&lcnt).Error; err != nil {
 		return ret, err
 	}
 	// 获取楼层未读数
@@ -25,9 +31,19 @@ func GetMessageCount(uid string) (MessageCount, error) {
 		return ret, err
 	}
 	// 获取通知未读数
-	if err := db.Model(&LogUnreadNotice{}).Where("uid = ?", uid).Count(&ncnt).Error; err != nil {
+	if err := db.Model(&LogUnreadNotice{}).
+		Where("uid = ? AND is_read = false AND pub_at < ?", uid, gorm.Expr("CURRENT_TIMESTAMP")).
+		Count(&ncnt).Error; err != nil {
+		return ret, err
+	}
+	// 加上未读的广播通知
+	var bcnt int64
+	if err := visibleBroadcastNotices(util.AsUint(uid)).Select("qnhd.notice.id").
+		Where("COALESCE(l.is_read, false) = false").
+		Count(&bcnt).Error; err != nil {
 		return ret, err
 	}
+	ncnt += bcnt
 	ret.Like = int(lcnt)
 	ret.Floor = int(fcnt)
 	ret.Reply = int(rcnt)
@@ -43,8 +59,11 @@ func ReadAllMessage(uid uint64) error {
 	if err := db.Model(&LogUnreadPostReply{}).Where("uid = ?", uid).Update("is_read", true).Error; err != nil {
 		return err
 	}
-	if err := db.Where("uid = ?", uid).Delete(&LogUnreadLike{}).Error; err != nil {
+	if err := db.Model(&LogUnreadLike{}).Where("uid = ?", uid).Update("is_read", true).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&LogUnreadNotice{}).Where("uid = ?", uid).Update("is_read", true).Error; err != nil {
 		return err
 	}
-	return db.Where("uid = ?", uid).Delete(&LogUnreadNotice{}).Error
+	return readAllBroadcastNotices(uid)
 }
@@ -46,32 +46,17 @@ func GetUnreadFloors(c *gin.Context, uid string) ([]UnreadFloorResponse, error)
 
 	// 对每个楼层分析
 	for _, f := range floors {
-		var r = UnreadFloorResponse{Floor: f.geneResponse(false, false)}
+		var isRead bool
 		for _, log := range logFloors {
 			if log.FloorId == f.Id {
-				r.IsRead = log.IsRead
+				isRead = log.IsRead
 			}
 		}
-		// 搜索floor
-		if f.SubTo > 0 {
-			tof, e := GetFloor(util.AsStrU(f.ReplyTo))
-			if e != nil {
-				err = e
-				break
-			}
-			r.Type = 1
-			tofr := tof.geneResponse(false, false)
-			r.ToFloor = &tofr
-		} else {
-			r.Type = 0
-		}
-		// 搜索帖子
-		p, e := GetPost(util.AsStrU(f.PostId))
+		r, e := geneUnreadFloorResponse(f, isRead)
 		if e != nil {
 			err = e
 			break
 		}
-		r.Post = p.geneResponse(false)
 		ret = append(ret, r)
 	}
 	if err != gorm.ErrRecordNotFound {
@@ -80,6 +65,29 @@ func GetUnreadFloors(c *gin.Context, uid string) ([]UnreadFloorResponse, error)
 	return ret, nil
 }
 
+func geneUnreadFloorResponse(f Floor, isRead bool) (UnreadFloorResponse, error) {
+	var r = UnreadFloorResponse{Floor: f.geneResponse(false, false), IsRead: isRead}
+	// 搜索floor
+	if f.SubTo > 0 {
+		tof, err := GetFloor(util.AsStrU(f.ReplyTo))
+		if err != nil {
+			return r, err
+		}
+		r.Type = 1
+		tofr := tof.geneResponse(false, false)
+		r.ToFloor = &tofr
+	} else {
+		r.Type = 0
+	}
+	// 搜索帖子
+	p, err := GetPost(util.AsStrU(f.PostId))
+	if err != nil {
+		return r, err
+	}
+	r.Post = p.geneResponse(false)
+	return r, nil
+}
+
 // 添加评论通知
 func addUnreadFloor(floorId uint64, uids ...uint64) error {
 	var logs []LogUnreadFloor
@@ -95,6 +103,7 @@ func addUnreadFloor(floorId uint64, uids ...uint64) error {
 		}
 		db.Create(logs[i*insertCount : min])
 	}
+	publishMessageEvent(MESSAGE_EVENT_FLOOR, floorId, uids...)
 	return nil
 }
 
@@ -1,60 +1,208 @@
 package models
 
 import (
+	"fmt"
 	"qnhd/enums/LikeType"
+	"qnhd/enums/NoticeType"
+	"qnhd/enums/NotificationEventType"
 	"qnhd/pkg/util"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type LogUnreadLike struct {
 	// 通知归属
-	Uid       uint64        `json:"uid"`
-	Type      LikeType.Enum `json:"type"`
-	Id        uint64        `json:"id"`
-	CreatedAt string        `json:"created_at" gorm:"default:null;"`
+	Uid    uint64        `json:"uid"`
+	Type   LikeType.Enum `json:"type"`
+	Id     uint64        `json:"id"`
+	IsRead bool          `json:"is_read" gorm:"default:false"`
+	// 点赞人数，以点赞记录为准
+	Count     int    `json:"count" gorm:"default:1"`
+	CreatedAt string `json:"created_at" gorm:"default:null;"`
+	// 最近一次点赞时间
+	UpdatedAt string `json:"updated_at" gorm:"default:null;"`
 }
 
 type UnreadLikeResponse struct {
 	// 0为帖子 1位floor
-	Type  int          `json:"type"`
-	Post  PostResponse `json:"post"`
-	Floor Floor        `json:"floor"`
+	Type      int          `json:"type"`
+	IsRead    bool         `json:"is_read"`
+	Count     int          `json:"count"`
+	UpdatedAt string       `json:"updated_at"`
+	Post      PostResponse `json:"post"`
+	Floor     Floor        `json:"floor"`
+}
+
+// 点赞数达到时额外通知
+var likeMilestones = []uint64{10, 100, 1000}
+
+// 已经通知过的里程碑，避免取消点赞后重复通知
+type LogLikeMilestone struct {
+	Type      LikeType.Enum `json:"type"`
+	Id        uint64        `json:"id"`
+	Milestone uint64        `json:"milestone"`
+	CreatedAt string        `json:"created_at" gorm:"default:null;"`
 }
 
 func GetUnreadLikes(c *gin.Context, uid string) ([]UnreadLikeResponse, error) {
 	var (
 		ret  = []UnreadLikeResponse{}
 		logs []LogUnreadLike
+		ok   bool
 	)
 	// 找到log
-	if err := db.Where("uid = ?", uid).Scopes(util.Paginate(c)).Order("created_at DESC").Find(&logs).Error; err != nil {
+	if err := db.Where("uid = ?", uid).Scopes(util.Paginate(c)).Order("COALESCE(updated_at, created_at) DESC").Find(&logs).Error; err != nil {
 		return ret, err
 	}
-	// 逐个找floor
+	// 一次查出所有帖子和楼层
+	var postIds, floorIds []uint64
 	for _, log := range logs {
 		if log.Type == LikeType.POST {
-			p, _ := GetPostResponse(util.AsStrU(log.Id))
-			if p.Id > 0 {
-				r := UnreadLikeResponse{Type: int(log.Type), Post: p}
-				ret = append(ret, r)
+			postIds = append(postIds, log.Id)
+		} else if log.Type == LikeType.FLOOR {
+			floorIds = append(floorIds, log.Id)
+		}
+	}
+	var (
+		posts    []Post
+		floors   []Floor
+		postMap  = map[uint64]PostResponse{}
+		floorMap = map[uint64]Floor{}
+	)
+	if len(postIds) > 0 {
+		if err := db.Unscoped().Where("id IN (?)", postIds).Find(&posts).Error; err != nil {
+			return ret, err
+		}
+		prs, _ := transPostsToResponses(&posts)
+		for _, pr := range prs {
+			postMap[pr.Id] = pr
+		}
+	}
+	if len(floorIds) > 0 {
+		if err := db.Where("id IN (?)", floorIds).Find(&floors).Error; err != nil {
+			return ret, err
+		}
+		for _, f := range floors {
+			floorMap[f.Id] = f
+		}
+	}
+	for _, log := range logs {
+		r := newUnreadLikeResponse(log)
+		if log.Type == LikeType.POST {
+			if r.Post, ok = postMap[log.Id]; !ok {
+				continue
 			}
 		} else if log.Type == LikeType.FLOOR {
-			r := UnreadLikeResponse{Type: int(log.Type)}
-			db.Where("id = ?", log.Id).Find(&r.Floor)
-			if r.Floor.Id > 0 {
-				ret = append(ret, r)
+			if r.Floor, ok = floorMap[log.Id]; !ok {
+				continue
 			}
 		}
+		ret = append(ret, r)
 	}
 	return ret, nil
 }
 
+func newUnreadLikeResponse(log LogUnreadLike) UnreadLikeResponse {
+	r := UnreadLikeResponse{Type: int(log.Type), IsRead: log.IsRead, Count: log.Count, UpdatedAt: log.UpdatedAt}
+	if r.UpdatedAt == "" {
+		r.UpdatedAt = log.CreatedAt
+	}
+	return r
+}
+
+// 点赞的对象已被删除时返回false
+func geneUnreadLikeResponse(log LogUnreadLike) (UnreadLikeResponse, bool) {
+	r := newUnreadLikeResponse(log)
+	if log.Type == LikeType.POST {
+		r.Post, _ = GetPostResponse(util.AsStrU(log.Id))
+		return r, r.Post.Id > 0
+	} else if log.Type == LikeType.FLOOR {
+		db.Where("id = ?", log.Id).Find(&r.Floor)
+		return r, r.Floor.Id > 0
+	}
+	return r, false
+}
+
+// 点赞对象所在的帖子
+func likePostId(likeType LikeType.Enum, id uint64) uint64 {
+	if likeType == LikeType.FLOOR {
+		var floor Floor
+		db.Select("post_id").Where("id = ?", id).Find(&floor)
+		return floor.PostId
+	}
+	return id
+}
+
+// 点赞的人数，取消后重新点赞不会重复计数
+func countLikers(likeType LikeType.Enum, id uint64) (int64, error) {
+	var cnt int64
+	var err error
+	if likeType == LikeType.FLOOR {
+		err = db.Model(&LogFloorLike{}).Where("floor_id = ?", id).Distinct("uid").Count(&cnt).Error
+	} else {
+		err = db.Model(&LogPostLike{}).Where("post_id = ?", id).Distinct("uid").Count(&cnt).Error
+	}
+	return cnt, err
+}
+
 func addUnreadLike(to uint64, likeType LikeType.Enum, id uint64) error {
-	log := LogUnreadLike{Uid: to, Type: likeType, Id: id}
-	return db.FirstOrCreate(&log, log).Error
+	// 判断所在帖子是否被屏蔽
+	if len(filterNotifyUids([]uint64{to}, NotificationEventType.LIKE, NOTIFY_IN_APP, likePostId(likeType, id))) == 0 {
+		return nil
+	}
+	count, err := countLikers(likeType, id)
+	if err != nil {
+		return err
+	}
+	// 同一对象的点赞合并为一条，人数取绝对值，并发时重复执行结果相同
+	var log LogUnreadLike
+	if err := db.Where("uid = ? AND type = ? AND id = ?", to, likeType, id).Attrs(LogUnreadLike{Uid: to, Type: likeType, Id: id, Count: int(count)}).FirstOrCreate(&log).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&LogUnreadLike{}).Where("uid = ? AND type = ? AND id = ?", to, likeType, id).Updates(map[string]interface{}{
+		"count":      count,
+		"is_read":    false,
+		"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+	}).Error; err != nil {
+		return err
+	}
+	publishMessageEvent(MESSAGE_EVENT_LIKE, id, to)
+	return nil
 }
 
 func ReadLike(uid uint64, likeType LikeType.Enum, id uint64) error {
-	return db.Where("uid = ? AND type = ? AND id = ?", uid, likeType, id).Delete(&LogUnreadLike{}).Error
+	return db.Model(&LogUnreadLike{}).Where("uid = ? AND type = ? AND id = ?", uid, likeType, id).Update("is_read", true).Error
+}
+
+// 点赞数达到里程碑时通知
+func addLikeMilestone(to uint64, likeType LikeType.Enum, id uint64, likeCount uint64) error {
+	var milestone uint64
+	for _, m := range likeMilestones {
+		if likeCount == m {
+			milestone = m
+		}
+	}
+	if milestone == 0 {
+		return nil
+	}
+	log := LogLikeMilestone{Type: likeType, Id: id, Milestone: milestone}
+	res := db.Where(log).FirstOrCreate(&log)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	if len(filterNotifyUids([]uint64{to}, NotificationEventType.LIKE, NOTIFY_IN_APP, likePostId(likeType, id))) == 0 {
+		return nil
+	}
+	count := fmt.Sprintf("%d", milestone)
+	if likeType == LikeType.POST {
+		var post Post
+		db.Select("title").Where("id = ?", id).Find(&post)
+		return addNoticeWithTemplate(NoticeType.POST_LIKE_MILESTONE, []uint64{to}, []string{post.Title, count})
+	}
+	var floor Floor
+	db.Where("id = ?", id).Find(&floor)
+	var post Post
+	db.Select("title").Where("id = ?", floor.PostId).Find(&post)
+	return addNoticeWithTemplate(NoticeType.FLOOR_LIKE_MILESTONE, []uint64{to}, []string{post.Title, floor.Content, count})
 }
@@ -3,9 +3,12 @@ package models
 import (
 	"errors"
 	"math"
+	"qnhd/enums/NoticeType"
+	"qnhd/enums/NotificationEventType"
 	"qnhd/pkg/template"
 	"qnhd/pkg/util"
 	"qnhd/request/twtservice"
+	"sort"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,6 +17,8 @@ import (
 type UnreadNoticeResponse struct {
 	Notice
 	IsRead bool `json:"is_read" gorm:"-"`
+	// 广播通知的id为通知id
+	Broadcast bool `json:"broadcast" gorm:"-"`
 }
 
 type LogUnreadNotice struct {
@@ -32,7 +37,10 @@ type userResult struct {
 
 type noticeResult struct {
 	LogUnreadNotice
-	Notice
+	Sender  string
+	Title   string
+	Content string
+	Symbol  string
 }
 
 // 获取未读的所有notice
@@ -42,16 +50,60 @@ func GetUnreadNotices(c *gin.Context, uid uint64) ([]UnreadNoticeResponse, error
 		ret  = []UnreadNoticeResponse{}
 	)
 	p := db.Model(&LogUnreadNotice{}).Where("uid = ? AND pub_at < ?", uid, gorm.Expr("CURRENT_TIMESTAMP"))
-	if err := db.Unscoped().Table("(?) as p", p).
-		Select("p.*, n.title, n.content, n.sender").
+	if err := findNoticeResults(p, &logs); err != nil {
+		return ret, err
+	}
+	ret = append(ret, geneUnreadNoticeResponses(c, logs)...)
+	// 合并广播通知
+	broadcasts, err := getBroadcastNotices(uid)
+	if err != nil {
+		return ret, err
+	}
+	for _, b := range broadcasts {
+		ret = append(ret, geneBroadcastNoticeResponse(b))
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].CreatedAt > ret[j].CreatedAt
+	})
+	return ret, nil
+}
+
+// 联表查出通知内容
+func findNoticeResults(p *gorm.DB, logs *[]noticeResult) error {
+	return db.Unscoped().Table("(?) as p", p).
+		Select("p.*, n.title, n.content, n.sender, n.symbol").
 		Joins("JOIN qnhd.notice as n ON n.id = p.notice_id").
 		Order("p.id DESC").
-		Find(&logs).Error; err != nil {
-		return ret, err
+		Find(logs).Error
+}
+
+func geneUnreadNoticeResponses(c *gin.Context, logs []noticeResult) []UnreadNoticeResponse {
+	var ret = []UnreadNoticeResponse{}
+	// 系统通知按请求语言替换模板
+	locale := ParseLocale(c.GetHeader("Accept-Language"))
+	if l := c.Query("locale"); l != "" {
+		locale = ParseLocale(l)
+	}
+	localized := map[string]Notice{}
+	for i, log := range logs {
+		if locale == DEFAULT_LOCALE {
+			break
+		}
+		if _, ok := NoticeType.FromSymbol(log.Symbol); !ok {
+			continue
+		}
+		n, ok := localized[log.Symbol]
+		if !ok {
+			n, _ = getNoticeTemplate(log.Symbol, locale)
+			localized[log.Symbol] = n
+		}
+		if n.Id > 0 {
+			logs[i].Sender, logs[i].Title, logs[i].Content = n.Sender, n.Title, n.Content
+		}
 	}
 	for _, log := range logs {
 		var resp = UnreadNoticeResponse{
-			Notice: log.Notice,
+			Notice: Notice{Sender: log.Sender, Title: log.Title},
 			IsRead: log.IsRead,
 		}
 		resp.Id = log.LogUnreadNotice.Id
@@ -60,37 +112,44 @@ func GetUnreadNotices(c *gin.Context, uid uint64) ([]UnreadNoticeResponse, error
 		resp.Content, _ = template.GeneTemplateString(log.Content, log.Args)
 		ret = append(ret, resp)
 	}
-	return ret, nil
+	return ret
 }
 
-// 通知所有用户
-func addUnreadNoticeToAllUser(noticeId uint64, pubAt string, departmentOnly bool) error {
-	var (
-		notice  Notice
-		users   []userResult
-		numbers []string
-	)
+func geneBroadcastNoticeResponse(b broadcastResult) UnreadNoticeResponse {
+	var resp = UnreadNoticeResponse{
+		Notice:    b.Notice,
+		IsRead:    b.IsRead,
+		Broadcast: true,
+	}
+	if b.PubAt != "" {
+		resp.CreatedAt = b.PubAt
+	}
+	return resp
+}
+
+// 向受众推送通知
+func pushNoticeToAudience(noticeId uint64, audience NoticeAudience) error {
+	var notice Notice
 	if err := db.Where("id = ?", noticeId).Find(&notice).Error; err != nil {
 		return err
 	}
-	// 查询所有用户id
-	if err := db.Model(&User{}).Select("id", "number").Where("is_user = true AND active = true").Find(&users).Error; err != nil {
+	users, err := getAudienceUsers(audience)
+	if err != nil {
 		return err
 	}
-	var logs []LogUnreadNotice
+	var numbers []string
+	off := getNotifyDisabledUids(NotificationEventType.NOTICE, NOTIFY_PUSH)
 	for _, u := range users {
-		logs = append(logs, LogUnreadNotice{Uid: u.Id, NoticeId: notice.Id, PubAt: pubAt})
-		numbers = append(numbers, u.Number)
-	}
-	if !departmentOnly {
-		// 一次插入2个参数，只要少于65535就ok，经测试250效率较高
-		insertCount := 250
-		for i := 0; i < int(math.Ceil(float64(len(logs))/float64(insertCount))); i++ {
-			min := (i + 1) * insertCount
-			if len(logs) < min {
-				min = len(logs)
-			}
-			db.Create(logs[i*insertCount : min])
+		if !off[u.Id] {
+			numbers = append(numbers, u.Number)
+		}
+	}
+	// 部门通知不进入站内消息
+	if notice.Broadcast {
+		if audience.IsEmpty() {
+			publishMessageEvent(MESSAGE_EVENT_NOTICE, notice.Id, 0)
+		} else {
+			publishTargetedNotice(notice.Id)
 		}
 	}
 	twtservice.NotifyNotice(notice.Sender, notice.Title, numbers...)
@@ -99,8 +158,8 @@ func addUnreadNoticeToAllUser(noticeId uint64, pubAt string, departmentOnly bool
 
 // 模板通知用户
 func addUnreadNoticeToUser(uid []uint64, data map[string]interface{}) error {
-	var notice Notice
-	if err := db.Where("symbol = ?", data["symbol"].(string)).Find(&notice).Error; err != nil {
+	notice, err := getNoticeTemplate(data["symbol"].(string), DEFAULT_LOCALE)
+	if err != nil {
 		return err
 	}
 	var logs []LogUnreadNotice
@@ -111,6 +170,13 @@ func addUnreadNoticeToUser(uid []uint64, data map[string]interface{}) error {
 			NoticeId: notice.Id,
 			Args:     data["args"].(string),
 		})
+	}
+	// 推送按对应的通知设置过滤
+	event := NotificationEventType.NOTICE
+	if e, ok := data["event"].(NotificationEventType.Enum); ok {
+		event = e
+	}
+	for _, u := range filterNotifyUids(uid, event, NOTIFY_PUSH, 0) {
 		uidStrs = append(uidStrs, util.AsStrU(u))
 	}
 	insertCount := 250
@@ -121,18 +187,27 @@ func addUnreadNoticeToUser(uid []uint64, data map[string]interface{}) error {
 		}
 		db.Create(logs[i*insertCount : min])
 	}
+	publishMessageEvent(MESSAGE_EVENT_NOTICE, notice.Id, uid...)
 	twtservice.NotifyNotice(notice.Sender, notice.Title, uidStrs...)
 	return nil
 }
 
 // 已读通知
-func ReadNotice(uid, noticeId uint64) error {
+func ReadNotice(uid, noticeId uint64, broadcast bool) error {
+	if broadcast {
+		return readBroadcastNotice(uid, noticeId)
+	}
 	return db.Model(&LogUnreadNotice{}).Where("uid = ? AND id = ?", uid, noticeId).Update("is_read", true).Error
 }
 
 // 删除通知记录
-func DeleteMessageNotices(uid string, ids []string) error {
-	return db.Where("uid = ? AND id IN (?)", uid, ids).Delete(&LogUnreadNotice{}).Error
+func DeleteMessageNotices(uid string, ids []string, broadcastIds []uint64) error {
+	if len(ids) > 0 {
+		if err := db.Where("uid = ? AND id IN (?)", uid, ids).Delete(&LogUnreadNotice{}).Error; err != nil {
+			return err
+		}
+	}
+	return deleteBroadcastNotices(util.AsUint(uid), broadcastIds)
 }
 
 // 是否通知已读
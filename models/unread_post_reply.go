@@ -41,30 +41,38 @@ func GetUnreadPostReplys(c *gin.Context, uid string) ([]UnreadReplyResponse, err
 	}
 	// 再生成返回数据
 	for _, r := range replys {
-		rp, e := r.geneResponse()
-		if e != nil {
-			logging.Error(e.Error())
-		}
-		var u = UnreadReplyResponse{Reply: rp}
-		// 搜索帖子
-		p, e := GetPost(util.AsStrU(rp.PostId))
-		if e != nil {
-			err = e
-			break
-		}
-		u.Post = p.geneResponse(false)
 		// 加上未读
+		var isRead bool
 		for _, l := range logPrs {
 			if l.ReplyId == r.Id {
-				u.IsRead = l.IsRead
+				isRead = l.IsRead
 			}
 		}
-
+		u, e := geneUnreadReplyResponse(r, isRead)
+		if e != nil {
+			err = e
+			break
+		}
 		ret = append(ret, u)
 	}
 	return ret, err
 }
 
+func geneUnreadReplyResponse(r PostReply, isRead bool) (UnreadReplyResponse, error) {
+	rp, err := r.geneResponse()
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	var u = UnreadReplyResponse{Reply: rp, IsRead: isRead}
+	// 搜索帖子
+	p, err := GetPost(util.AsStrU(rp.PostId))
+	if err != nil {
+		return u, err
+	}
+	u.Post = p.geneResponse(false)
+	return u, nil
+}
+
 // 添加回复通知
 func AddUnreadPostReply(postId, replyId uint64) error {
 	var (
@@ -88,6 +96,7 @@ func AddUnreadPostReply(postId, replyId uint64) error {
 	}).Error; err != nil {
 		return err
 	}
+	publishMessageEvent(MESSAGE_EVENT_REPLY, replyId, uid)
 	twtservice.NotifyPostReply(post.Title, user.Number)
 	return nil
 }
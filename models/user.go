@@ -26,7 +26,12 @@ type User struct {
 	IsSchDistributeAdmin bool   `json:"is_sch_dis_admin" gorm:"default:false;column:school_distribute_admin"`
 	IsUser               bool   `json:"is_user" gorm:"default:false;"`
 	Active               bool   `json:"active" gorm:"default:true"`
-	CreatedAt            string `json:"-" gorm:"autoCreateTime;default:null;"`
+	HistoryDisabled      bool   `json:"history_disabled" gorm:"default:false"`
+	// 重置密码后需要先修改密码
+	MustChangePassword  bool       `json:"must_change_password" gorm:"default:false"`
+	PasswordFailedCount int        `json:"-" gorm:"default:0"`
+	PasswordLockedUntil *time.Time `json:"-"`
+	CreatedAt           string     `json:"-" gorm:"autoCreateTime;default:null;"`
 }
 
 type NewUserData struct {
@@ -39,42 +44,20 @@ type NewUserData struct {
 	DepartmentId int    `json:"department_id"`
 }
 
-type UserRight struct {
-	Super              bool
-	SchAdmin           bool
-	SchDistributeAdmin bool
-	StuAdmin           bool
-}
-
-func RequireRight(uid string, right UserRight) bool {
-	// 检查权限
-	user, _ := GetUser(map[string]interface{}{"id": uid})
-	var b = false
-	if right.Super {
-		b = b || user.IsSuper
-	}
-	if right.SchAdmin {
-		b = b || user.IsSchAdmin
-	}
-	if right.StuAdmin {
-		b = b || user.IsStuAdmin
-	}
-	if right.SchDistributeAdmin {
-		b = b || user.IsSchDistributeAdmin
-	}
-	return b
-}
-
 func RequireAdmin(uid string) error {
 	// 检查权限
-	user, err := GetUser(map[string]interface{}{"id": uid})
-	if err != nil {
+	if _, err := GetUser(map[string]interface{}{"id": uid}); err != nil {
 		if errors.Is(gorm.ErrRecordNotFound, err) {
 			return fmt.Errorf("未注册用户")
 		}
 		return err
 	}
-	if !user.IsSuper && !user.IsSchAdmin && !user.IsStuAdmin {
+	// 有任意角色即为管理员
+	var cnt int64
+	if err := db.Model(&UserRole{}).Where("uid = ?", uid).Count(&cnt).Error; err != nil {
+		return err
+	}
+	if cnt == 0 {
 		return fmt.Errorf("无管理员权限")
 	}
 	return nil
@@ -171,6 +154,10 @@ func GetUser(maps map[string]interface{}) (User, error) {
 }
 
 func AddUser(nickname, number, password, phoneNumber, realname string, isUser bool) (uint64, error) {
+	password, err := hashPasswordIfSet(password)
+	if err != nil {
+		return 0, err
+	}
 	var user = User{
 		Nickname:    nickname,
 		Number:      number,
@@ -185,7 +172,7 @@ func AddUser(nickname, number, password, phoneNumber, realname string, isUser bo
 	return user.Uid, nil
 }
 
-func AddUsers(users []NewUserData) error {
+func AddUsers(uid string, users []NewUserData) error {
 	// 先检查是否合理
 	var err error
 	for i, u := range users {
@@ -196,17 +183,29 @@ func AddUsers(users []NewUserData) error {
 	if err != nil {
 		return err
 	}
+	for i, u := range users {
+		if e := util.CheckPasswordPolicy(u.Password); e != nil {
+			return fmt.Errorf("line %v: %v", i, e)
+		}
+	}
 	var newUsers []User
 	for _, u := range users {
+		password, e := hashPasswordIfSet(u.Password)
+		if e != nil {
+			return e
+		}
 		new := User{
 			Nickname:    u.Nickname,
-			Password:    u.Password,
+			Password:    password,
 			PhoneNumber: u.PhoneNumber,
 			IsSuper:     u.IsSuper,
 			IsSchAdmin:  u.IsSchAdmin,
 			IsStuAdmin:  u.IsSchAdmin,
 			IsUser:      false,
 		}
+		if !canGrantFlagRoles(uid, new) {
+			return ErrPermissionExceeded
+		}
 		newUsers = append(newUsers, new)
 	}
 	// 一次插入2个参数，只要少于65535就ok
@@ -220,6 +219,15 @@ func AddUsers(users []NewUserData) error {
 			err = giterrors.Wrap(err, e.Error())
 		}
 	}
+	// 分配对应的角色
+	for _, new := range newUsers {
+		if new.Uid == 0 {
+			continue
+		}
+		if e := addFlagRoles(db, new); e != nil {
+			err = giterrors.Wrap(err, e.Error())
+		}
+	}
 	// 看是否需要创建部门
 	for i, new := range newUsers {
 		if users[i].DepartmentId > 0 {
@@ -273,17 +281,11 @@ func genNickname() string {
 	return ret
 }
 
-// 修改密码，要求原密码
-func EditUserPasswd(uid string, rawPasswd, newPasswd string) error {
-	var user User
-	if err := db.Where("id = ? AND password = ?", uid, rawPasswd).First(&user).Error; err != nil {
-		return err
-	}
-	return db.Model(&user).Update("password", newPasswd).Error
-}
-
 // 删除用户
 func DeleteUser(uid uint64) error {
+	if err := deleteUserRoles(uid, "uid = ?", uid); err != nil {
+		return err
+	}
 	return db.Where("id = ?", uid).Delete(&User{}).Error
 }
 
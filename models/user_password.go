@@ -0,0 +1,143 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/setting"
+	"qnhd/pkg/util"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWrongPassword  = errors.New("账号或密码错误")
+	ErrPasswordLocked = errors.New("密码错误次数过多")
+)
+
+// 后台账号登录，依次按昵称、学号、手机号查找
+func CheckAdminLogin(account, password string) (User, error) {
+	var user User
+	for _, col := range []string{"nickname", "number", "phone_number"} {
+		if err := db.Where(col+" = ? AND is_user = false", account).Order("id").Find(&user).Error; err != nil {
+			return User{}, err
+		}
+		if user.Uid > 0 {
+			break
+		}
+	}
+	if user.Uid == 0 {
+		return user, ErrWrongPassword
+	}
+	if user.PasswordLockedUntil != nil && time.Now().Before(*user.PasswordLockedUntil) {
+		return User{}, fmt.Errorf("%w，请%d分钟后再试", ErrPasswordLocked, int(time.Until(*user.PasswordLockedUntil).Minutes())+1)
+	}
+	ok, rehash := util.CheckPassword(user.Password, password)
+	if !ok {
+		addPasswordFailure(&user)
+		return User{}, ErrWrongPassword
+	}
+	maps := map[string]interface{}{
+		"password_failed_count": 0,
+		"password_locked_until": nil,
+	}
+	// 明文或旧参数的密码在登录成功时重新生成
+	if rehash {
+		if hash, err := util.HashPassword(password); err != nil {
+			logging.Error("rehash password error: %v", err)
+		} else {
+			maps["password"] = hash
+		}
+	}
+	if err := db.Model(&User{}).Where("id = ?", user.Uid).Updates(maps).Error; err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+// 记录失败次数，达到上限后锁定
+func addPasswordFailure(user *User) {
+	maps := map[string]interface{}{
+		"password_failed_count": gorm.Expr("password_failed_count + 1"),
+	}
+	if user.PasswordFailedCount+1 >= setting.PasswordSetting.MaxFailed {
+		maps["password_failed_count"] = 0
+		maps["password_locked_until"] = time.Now().Add(time.Duration(setting.PasswordSetting.LockMinutes) * time.Minute)
+	}
+	if err := db.Model(&User{}).Where("id = ?", user.Uid).Updates(maps).Error; err != nil {
+		logging.Error("add password failure error: %v", err)
+	}
+}
+
+// 空密码表示不能用密码登录，不做处理
+func hashPasswordIfSet(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	return util.HashPassword(password)
+}
+
+// 修改密码，要求原密码，并注销当前会话以外的登录
+func EditUserPasswd(uid string, rawPasswd, newPasswd, keepSid string) error {
+	var user User
+	if err := db.Where("id = ?", uid).First(&user).Error; err != nil {
+		return err
+	}
+	if ok, _ := util.CheckPassword(user.Password, rawPasswd); !ok {
+		return fmt.Errorf("原密码错误")
+	}
+	if rawPasswd == newPasswd {
+		return fmt.Errorf("新密码不能与原密码相同")
+	}
+	if err := util.CheckPasswordPolicy(newPasswd); err != nil {
+		return err
+	}
+	hash, err := util.HashPassword(newPasswd)
+	if err != nil {
+		return err
+	}
+	if err := db.Model(&User{}).Where("id = ?", user.Uid).Updates(map[string]interface{}{
+		"password":             hash,
+		"must_change_password": false,
+	}).Error; err != nil {
+		return err
+	}
+	return RevokeUserSessions(user.Uid, keepSid)
+}
+
+// 超管重置密码，不传密码时生成临时密码，用户下次登录后必须修改
+func ResetUserPasswd(uid, newPasswd string) (string, error) {
+	var err error
+	if newPasswd == "" {
+		if newPasswd, err = util.RandomPassword(); err != nil {
+			return "", err
+		}
+	} else if err = util.CheckPasswordPolicy(newPasswd); err != nil {
+		return "", err
+	}
+	hash, err := util.HashPassword(newPasswd)
+	if err != nil {
+		return "", err
+	}
+	res := db.Model(&User{}).Where("id = ? AND is_user = false", uid).Updates(map[string]interface{}{
+		"password":              hash,
+		"must_change_password":  true,
+		"password_failed_count": 0,
+		"password_locked_until": nil,
+	})
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", fmt.Errorf("管理员不存在")
+	}
+	return newPasswd, RevokeUserSessions(util.AsUint(uid), "")
+}
+
+// 是否需要先修改密码
+func MustChangePassword(uid string) bool {
+	var user User
+	db.Select("must_change_password").Where("id = ?", uid).Find(&user)
+	return user.MustChangePassword
+}
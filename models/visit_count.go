@@ -0,0 +1,128 @@
+package models
+
+import (
+	"math"
+	"qnhd/pkg/logging"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// 帖子浏览计数
+type PostVisitCount struct {
+	PostId uint64 `json:"post_id"`
+	// 总浏览次数
+	Total int64 `json:"total" gorm:"default:0"`
+	// 独立访客数
+	UniqueCount int64 `json:"unique_count" gorm:"default:0"`
+}
+
+// 访问过帖子的用户，用于计算独立访客
+type LogPostVisitor struct {
+	PostId uint64 `json:"post_id"`
+	Uid    uint64 `json:"uid"`
+}
+
+// 浏览计数缓冲，定时写入数据库，锁不替换，只替换map
+var visits = struct {
+	sync.Mutex
+	total    map[uint64]int64
+	visitors map[uint64]map[uint64]bool
+}{
+	total:    map[uint64]int64{},
+	visitors: map[uint64]map[uint64]bool{},
+}
+
+func bufferVisit(uid, postId uint64) {
+	visits.Lock()
+	defer visits.Unlock()
+	visits.total[postId]++
+	if visits.visitors[postId] == nil {
+		visits.visitors[postId] = map[uint64]bool{}
+	}
+	visits.visitors[postId][uid] = true
+}
+
+// 把缓冲的浏览写入计数表
+func FlushVisitCounts() error {
+	visits.Lock()
+	totals, visitors := visits.total, visits.visitors
+	visits.total = map[uint64]int64{}
+	visits.visitors = map[uint64]map[uint64]bool{}
+	visits.Unlock()
+
+	for postId, total := range totals {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// 新访客才计入独立访客
+			var uids, seen []uint64
+			for uid := range visitors[postId] {
+				uids = append(uids, uid)
+			}
+			if err := tx.Model(&LogPostVisitor{}).Select("uid").Where("post_id = ? AND uid IN (?)", postId, uids).Find(&seen).Error; err != nil {
+				return err
+			}
+			var news []LogPostVisitor
+			for _, uid := range uids {
+				if !containsUint64(seen, uid) {
+					news = append(news, LogPostVisitor{PostId: postId, Uid: uid})
+				}
+			}
+			insertCount := 250
+			for i := 0; i < int(math.Ceil(float64(len(news))/float64(insertCount))); i++ {
+				min := (i + 1) * insertCount
+				if len(news) < min {
+					min = len(news)
+				}
+				if err := tx.Create(news[i*insertCount : min]).Error; err != nil {
+					return err
+				}
+			}
+			res := tx.Model(&PostVisitCount{}).Where("post_id = ?", postId).Updates(map[string]interface{}{
+				"total":        gorm.Expr("total + ?", total),
+				"unique_count": gorm.Expr("unique_count + ?", len(news)),
+			})
+			if res.Error != nil || res.RowsAffected > 0 {
+				return res.Error
+			}
+			return tx.Create(&PostVisitCount{PostId: postId, Total: total, UniqueCount: int64(len(news))}).Error
+		})
+		if err != nil {
+			logging.Error("flush visit count of post %d error: %v", postId, err)
+		}
+	}
+	return nil
+}
+
+func containsUint64(list []uint64, v uint64) bool {
+	for _, l := range list {
+		if l == v {
+			return true
+		}
+	}
+	return false
+}
+
+// 从浏览日志回填计数，只处理还没有计数的帖子
+func FlushPostVisitCounts() error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`INSERT INTO qnhd.log_post_visitor (post_id, uid)
+		SELECT DISTINCT l.post_id, l.uid FROM qnhd.log_visit_history AS l
+		WHERE l.post_id NOT IN (SELECT post_id FROM qnhd.post_visit_count)`).Error; err != nil {
+			return err
+		}
+		// 已聚合的每日计数没有用户信息，只计入总数
+		return tx.Exec(`INSERT INTO qnhd.post_visit_count (post_id, total, unique_count)
+		SELECT p.id,
+			(SELECT COUNT(*) FROM qnhd.log_visit_history WHERE post_id = p.id) +
+			(SELECT COALESCE(SUM(count), 0) FROM qnhd.log_visit_daily WHERE post_id = p.id),
+			(SELECT COUNT(DISTINCT uid) FROM qnhd.log_visit_history WHERE post_id = p.id)
+		FROM qnhd.post AS p
+		WHERE p.id NOT IN (SELECT post_id FROM qnhd.post_visit_count)`).Error
+	})
+}
+
+func getPostVisitCount(postId uint64) PostVisitCount {
+	var cnt PostVisitCount
+	db.Where("post_id = ?", postId).Find(&cnt)
+	return cnt
+}
@@ -0,0 +1,281 @@
+package avatar
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	MARBLE  = "marble"
+	BEAM    = "beam"
+	PIXEL   = "pixel"
+	SUNSET  = "sunset"
+	RING    = "ring"
+	BAUHAUS = "bauhaus"
+)
+
+var Variants = []string{MARBLE, BEAM, PIXEL, SUNSET, RING, BAUHAUS}
+
+// 默认配色
+var DefaultColors = []string{"#92A1C6", "#146A7C", "#F0AB3D", "#C271B4", "#C20D90"}
+
+const (
+	DEFAULT_SIZE = 80
+	MAX_SIZE     = 512
+)
+
+type Options struct {
+	Variant string
+	Name    string
+	Size    int
+	Colors  []string
+	Square  bool
+}
+
+func IsValidVariant(variant string) bool {
+	for _, v := range Variants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// 解析以逗号分隔的颜色，可以不带#
+func ParseColors(s string) ([]string, error) {
+	if s == "" {
+		return DefaultColors, nil
+	}
+	var colors []string
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimPrefix(strings.TrimSpace(c), "#")
+		if len(c) != 6 && len(c) != 3 {
+			return nil, fmt.Errorf("颜色格式错误: %s", c)
+		}
+		if _, err := strconv.ParseUint(c, 16, 32); err != nil {
+			return nil, fmt.Errorf("颜色格式错误: %s", c)
+		}
+		colors = append(colors, "#"+c)
+	}
+	return colors, nil
+}
+
+// 生成svg头像，相同参数结果相同
+func Render(o Options) string {
+	if len(o.Colors) == 0 {
+		o.Colors = DefaultColors
+	}
+	if o.Size <= 0 {
+		o.Size = DEFAULT_SIZE
+	}
+	num := getNumber(o.Name)
+	switch o.Variant {
+	case MARBLE:
+		return marble(num, o)
+	case PIXEL:
+		return pixel(num, o)
+	case SUNSET:
+		return sunset(num, o)
+	case RING:
+		return ring(num, o)
+	case BAUHAUS:
+		return bauhaus(num, o)
+	default:
+		return beam(num, o)
+	}
+}
+
+// 与boring-avatars相同的取数方式，保证原来的头像不变
+func getNumber(name string) int {
+	var sum int
+	for _, r := range name {
+		sum += int(r)
+	}
+	return sum
+}
+
+func getDigit(number, ntn int) int {
+	return int(math.Floor(float64(number)/math.Pow(10, float64(ntn)))) % 10
+}
+
+func getBoolean(number, ntn int) bool {
+	return getDigit(number, ntn)%2 == 0
+}
+
+func getUnit(number, rng, index int) int {
+	value := number % rng
+	if index > 0 && getDigit(number, index)%2 == 0 {
+		return -value
+	}
+	return value
+}
+
+func getColor(number int, colors []string) string {
+	return colors[number%len(colors)]
+}
+
+func getContrast(hex string) string {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	r, _ := strconv.ParseUint(hex[0:2], 16, 8)
+	g, _ := strconv.ParseUint(hex[2:4], 16, 8)
+	b, _ := strconv.ParseUint(hex[4:6], 16, 8)
+	if (r*299+g*587+b*114)/1000 >= 128 {
+		return "#000000"
+	}
+	return "#FFFFFF"
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// 外层svg和圆形遮罩
+func wrap(o Options, box int, body string) string {
+	rx := ""
+	if !o.Square {
+		rx = fmt.Sprintf(` rx="%d"`, box*2)
+	}
+	return fmt.Sprintf(`<svg viewBox="0 0 %[1]d %[1]d" fill="none" role="img" xmlns="http://www.w3.org/2000/svg" width="%[2]d" height="%[2]d">`+
+		`<mask id="mask__%[3]s" maskUnits="userSpaceOnUse" x="0" y="0" width="%[1]d" height="%[1]d"><rect width="%[1]d" height="%[1]d"%[4]s fill="#FFFFFF"/></mask>`+
+		`<g mask="url(#mask__%[3]s)">%[5]s</g></svg>`, box, o.Size, o.Variant, rx, body)
+}
+
+func marble(n int, o Options) string {
+	const size = 80
+	type prop struct {
+		color          string
+		tx, ty, rotate int
+		scale          float64
+	}
+	var p [3]prop
+	for i := range p {
+		p[i] = prop{
+			color:  getColor(n+i, o.Colors),
+			tx:     getUnit(n*(i+1), size/10, 1),
+			ty:     getUnit(n*(i+1), size/10, 2),
+			scale:  1.2 + float64(getUnit(n*(i+1), size/20, 0))/10,
+			rotate: getUnit(n*(i+1), 360, 1),
+		}
+	}
+	body := fmt.Sprintf(`<rect width="80" height="80" fill="%s"/>`, p[0].color) +
+		fmt.Sprintf(`<path filter="url(#filter_marble)" d="M32.414 59.35L50.376 70.5H72.5v-71H33.728L26.5 13.381l19.057 27.08L32.414 59.35z" fill="%s" transform="translate(%d %d) rotate(%d 40 40) scale(%s)"/>`,
+			p[1].color, p[1].tx, p[1].ty, p[1].rotate, num(p[2].scale)) +
+		fmt.Sprintf(`<path filter="url(#filter_marble)" style="mix-blend-mode:overlay" d="M22.216 24L0 46.75l14.108 38.129L78 86l-3.081-59.276-22.378 4.005 12.972 20.186-23.35 27.395L22.215 24z" fill="%s" transform="translate(%d %d) rotate(%d 40 40) scale(%s)"/>`,
+			p[2].color, p[2].tx, p[2].ty, p[2].rotate, num(p[2].scale)) +
+		`<defs><filter id="filter_marble" filterUnits="userSpaceOnUse" color-interpolation-filters="sRGB">` +
+		`<feFlood flood-opacity="0" result="BackgroundImageFix"/><feBlend in="SourceGraphic" in2="BackgroundImageFix" result="shape"/>` +
+		`<feGaussianBlur stdDeviation="7" result="effect1_foregroundBlur"/></filter></defs>`
+	return wrap(o, size, body)
+}
+
+func beam(n int, o Options) string {
+	const size = 36
+	wrapperColor := getColor(n, o.Colors)
+	faceColor := getContrast(wrapperColor)
+	backgroundColor := getColor(n+13, o.Colors)
+	tx := getUnit(n, 10, 1)
+	if tx < 5 {
+		tx += size / 9
+	}
+	ty := getUnit(n, 10, 2)
+	if ty < 5 {
+		ty += size / 9
+	}
+	wrapperRotate := getUnit(n, 360, 0)
+	wrapperScale := 1 + float64(getUnit(n, size/12, 0))/10
+	isMouthOpen := getBoolean(n, 2)
+	isCircle := getBoolean(n, 1)
+	eyeSpread := getUnit(n, 5, 0)
+	mouthSpread := getUnit(n, 3, 0)
+	faceRotate := getUnit(n, 10, 3)
+	faceTx, faceTy := float64(getUnit(n, 8, 1)), float64(getUnit(n, 7, 2))
+	if tx > size/6 {
+		faceTx = float64(tx) / 2
+	}
+	if ty > size/6 {
+		faceTy = float64(ty) / 2
+	}
+	rx := 6
+	if isCircle {
+		rx = size
+	}
+	mouth := fmt.Sprintf(`<path d="M13,%d a1,0.75 0 0,0 10,0" fill="%s"/>`, 19+mouthSpread, faceColor)
+	if isMouthOpen {
+		mouth = fmt.Sprintf(`<path d="M15 %dc2 1 4 1 6 0" stroke="%s" fill="none" stroke-linecap="round"/>`, 19+mouthSpread, faceColor)
+	}
+	body := fmt.Sprintf(`<rect width="36" height="36" fill="%s"/>`, backgroundColor) +
+		fmt.Sprintf(`<rect x="0" y="0" width="36" height="36" transform="translate(%d %d) rotate(%d 18 18) scale(%s)" fill="%s" rx="%d"/>`,
+			tx, ty, wrapperRotate, num(wrapperScale), wrapperColor, rx) +
+		fmt.Sprintf(`<g transform="translate(%s %s) rotate(%d 18 18)">`, num(faceTx), num(faceTy), faceRotate) + mouth +
+		fmt.Sprintf(`<rect x="%d" y="14" width="1.5" height="2" rx="1" stroke="none" fill="%s"/>`, 14-eyeSpread, faceColor) +
+		fmt.Sprintf(`<rect x="%d" y="14" width="1.5" height="2" rx="1" stroke="none" fill="%s"/>`, 20+eyeSpread, faceColor) +
+		`</g>`
+	return wrap(o, size, body)
+}
+
+func pixel(n int, o Options) string {
+	var b strings.Builder
+	for i := 0; i < 64; i++ {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, i%8*10, i/8*10, getColor(n%(i+1), o.Colors))
+	}
+	return wrap(o, 80, b.String())
+}
+
+func sunset(n int, o Options) string {
+	var c [4]string
+	for i := range c {
+		c[i] = getColor(n+i, o.Colors)
+	}
+	id := fmt.Sprintf("sunset_%d", n)
+	body := fmt.Sprintf(`<path fill="url(#%[1]s_0)" d="M0 0h80v40H0z"/><path fill="url(#%[1]s_1)" d="M0 40h80v40H0z"/>`, id) +
+		fmt.Sprintf(`<defs><linearGradient id="%s_0" x1="40" y1="0" x2="40" y2="40" gradientUnits="userSpaceOnUse"><stop stop-color="%s"/><stop offset="1" stop-color="%s"/></linearGradient>`, id, c[0], c[1]) +
+		fmt.Sprintf(`<linearGradient id="%s_1" x1="40" y1="40" x2="40" y2="80" gradientUnits="userSpaceOnUse"><stop stop-color="%s"/><stop offset="1" stop-color="%s"/></linearGradient></defs>`, id, c[2], c[3])
+	return wrap(o, 80, body)
+}
+
+func ring(n int, o Options) string {
+	var s [5]string
+	for i := range s {
+		s[i] = getColor(n+i, o.Colors)
+	}
+	c := []string{s[0], s[1], s[1], s[2], s[2], s[3], s[3], s[0], s[4]}
+	body := fmt.Sprintf(`<path d="M0 0h90v45H0z" fill="%s"/><path d="M0 45h90v45H0z" fill="%s"/>`, c[0], c[1]) +
+		fmt.Sprintf(`<path d="M83 45a38 38 0 00-76 0h76z" fill="%s"/><path d="M83 45a38 38 0 01-76 0h76z" fill="%s"/>`, c[2], c[3]) +
+		fmt.Sprintf(`<path d="M77 45a32 32 0 10-64 0h64z" fill="%s"/><path d="M77 45a32 32 0 11-64 0h64z" fill="%s"/>`, c[4], c[5]) +
+		fmt.Sprintf(`<path d="M71 45a26 26 0 00-52 0h52z" fill="%s"/><path d="M71 45a26 26 0 01-52 0h52z" fill="%s"/>`, c[6], c[7]) +
+		fmt.Sprintf(`<circle cx="45" cy="45" r="23" fill="%s"/>`, c[8])
+	return wrap(o, 90, body)
+}
+
+func bauhaus(n int, o Options) string {
+	const size = 80
+	type prop struct {
+		color          string
+		tx, ty, rotate int
+	}
+	var p [4]prop
+	for i := range p {
+		p[i] = prop{
+			color:  getColor(n+i, o.Colors),
+			tx:     getUnit(n*(i+1), size/2-(i+17), 1),
+			ty:     getUnit(n*(i+1), size/2-(i+17), 2),
+			rotate: getUnit(n*(i+1), 360, 0),
+		}
+	}
+	height := size / 8
+	if getBoolean(n, 2) {
+		height = size
+	}
+	body := fmt.Sprintf(`<rect width="80" height="80" fill="%s"/>`, p[0].color) +
+		fmt.Sprintf(`<rect x="10" y="30" width="80" height="%d" fill="%s" transform="translate(%d %d) rotate(%d 40 40)"/>`,
+			height, p[1].color, p[1].tx, p[1].ty, p[1].rotate) +
+		fmt.Sprintf(`<circle cx="40" cy="40" fill="%s" r="16" transform="translate(%d %d)"/>`, p[2].color, p[2].tx, p[2].ty) +
+		fmt.Sprintf(`<line x1="0" y1="40" x2="80" y2="40" stroke-width="2" stroke="%s" transform="translate(%d %d) rotate(%d 40 40)"/>`,
+			p[3].color, p[3].tx, p[3].ty, p[3].rotate)
+	return wrap(o, size, body)
+}
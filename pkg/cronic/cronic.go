@@ -3,7 +3,10 @@ package cronic
 import (
 	"qnhd/models"
 	"qnhd/pkg/logging"
+	"qnhd/pkg/ratelimit"
+	"qnhd/pkg/setting"
 	"qnhd/request/twtservice"
+	"time"
 
 	cron "github.com/robfig/cron/v3"
 )
@@ -11,7 +14,11 @@ import (
 var c *cron.Cron
 
 func Setup() {
-	err := models.FlushOldTagLog()
+	err := models.FlushTagScoreDaily()
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	err = models.FlushOldTagLog()
 	if err != nil {
 		logging.Error(err.Error())
 	}
@@ -19,11 +26,24 @@ func Setup() {
 	if err != nil {
 		logging.Error(err.Error())
 	}
-	// 定时任务
-	c = cron.New()
+	err = models.FlushPostTrending(true)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	err = models.FlushTagScores()
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	// 定时任务，使用带秒的格式
+	c = cron.New(cron.WithSeconds())
 	c.AddFunc("00 00 00 * * ?", func() {
+		// 汇总tag每日热度，需要在清理taglog之前
+		err := models.FlushTagScoreDaily()
+		if err != nil {
+			logging.Error(err.Error())
+		}
 		// 清理taglog
-		err := models.FlushOldTagLog()
+		err = models.FlushOldTagLog()
 		if err != nil {
 			logging.Error(err.Error())
 		}
@@ -32,11 +52,60 @@ func Setup() {
 		if err != nil {
 			logging.Error(err.Error())
 		}
-		// 清理已读点赞
+		// 清理过期的已读消息和日志
+		_, err = models.FlushRetention(false)
+		if err != nil {
+			logging.Error(err.Error())
+		}
+		// 清理过期的内容指纹
+		_, err = models.FlushContentHashes()
+		if err != nil {
+			logging.Error(err.Error())
+		}
+		// 清理过期的登录会话
+		_, err = models.FlushSessions()
+		if err != nil {
+			logging.Error(err.Error())
+		}
+	})
+	// 更新热门帖子，每小时全量计算一次
+	c.AddFunc("00 */5 * * * ?", func() {
+		full := time.Now().Minute() < 5
+		if err := models.FlushPostTrending(full); err != nil {
+			logging.Error(err.Error())
+		}
+	})
+	// 更新tag热度
+	c.AddFunc("30 */5 * * * ?", func() {
+		if err := models.FlushTagScores(); err != nil {
+			logging.Error(err.Error())
+		}
+	})
+	// 清理未被引用的图片
+	c.AddFunc("00 30 * * * ?", func() {
+		if _, err := models.FlushOrphanImages(); err != nil {
+			logging.Error(err.Error())
+		}
+	})
+	// 清理已补满的限流计数
+	c.AddFunc("@every 10m", func() {
+		ratelimit.Memory.Sweep()
+		if setting.RateLimitSetting.Store != "database" {
+			return
+		}
+		if _, err := models.FlushRateBuckets(); err != nil {
+			logging.Error(err.Error())
+		}
+	})
+	// 写入浏览计数
+	c.AddFunc("@every 1m", func() {
+		models.FlushVisitCounts()
 	})
 	c.Start()
 }
 
 func Close() {
 	c.Stop()
+	// 写入剩余的浏览计数
+	models.FlushVisitCounts()
 }
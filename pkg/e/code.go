@@ -16,6 +16,7 @@ const (
 	ERROR_EXIST_DEPARTMENT
 	ERROR_NOT_EXIST_DEPARTMENT
 	ERROR_POST_TYPE
+	ERROR_NOTICE_TEMPLATE
 )
 
 const (
@@ -23,6 +24,9 @@ const (
 	ERROR_NOT_BANNED_USER
 	ERROR_BLOCKED_USER
 	ERROR_NOT_BLOCKED_USER
+	ERROR_RATE_LIMIT
+	ERROR_DUPLICATE_CONTENT
+	ERROR_CONTENT_HELD
 )
 
 const (
@@ -31,12 +35,21 @@ const (
 	ERROR_GENERATE_TOKEN
 	ERROR_AUTH
 	ERROR_RIGHT
+	ERROR_AUTH_SESSION_REVOKED
+	ERROR_AUTH_LOCKED
+	ERROR_MUST_CHANGE_PASSWORD
+	ERROR_TOTP_REQUIRED
+	ERROR_TOTP_INVALID
+	ERROR_TOTP_NOT_ENROLLED
+	ERROR_TOTP_RECENT_REQUIRED
 )
 
 const (
 	ERROR_SEND_EMAIL = 30001 + iota
 	ERROR_SAVE_FILE
 	ERROR_SERVER
+	ERROR_CHECK_IMAGE_FORMAT
+	ERROR_CHECK_IMAGE_SIZE
 )
 
 const (
@@ -15,22 +15,36 @@ var MsgFlags = map[int]string{
 	ERROR_EXIST_DEPARTMENT:     "该部门已存在",
 	ERROR_NOT_EXIST_DEPARTMENT: "该部门不存在",
 	ERROR_POST_TYPE:            "帖子类型错误",
+	ERROR_NOTICE_TEMPLATE:      "通知模板参数错误",
 
-	ERROR_BANNED_USER:      "用户已被封禁",
-	ERROR_NOT_BANNED_USER:  "用户未被封禁",
-	ERROR_BLOCKED_USER:     "用户已被禁言",
-	ERROR_NOT_BLOCKED_USER: "用户未被禁言",
+	ERROR_BANNED_USER:       "用户已被封禁",
+	ERROR_NOT_BANNED_USER:   "用户未被封禁",
+	ERROR_BLOCKED_USER:      "用户已被禁言",
+	ERROR_NOT_BLOCKED_USER:  "用户未被禁言",
+	ERROR_RATE_LIMIT:        "操作过于频繁，请稍后再试",
+	ERROR_DUPLICATE_CONTENT: "与最近发布的内容重复",
+	ERROR_CONTENT_HELD:      "与最近发布的内容相似，已提交审核",
 
 	ERROR_AUTH_CHECK_TOKEN_FAIL:    "Token鉴权失败",
 	ERROR_AUTH_CHECK_TOKEN_TIMEOUT: "Token已超时",
 	ERROR_GENERATE_TOKEN:           "Token生成失败",
 	ERROR_AUTH:                     "账号密码错误",
 	ERROR_RIGHT:                    "无权访问",
+	ERROR_AUTH_SESSION_REVOKED:     "登录已失效，请重新登录",
+	ERROR_AUTH_LOCKED:              "密码错误次数过多，账号已暂时锁定",
+	ERROR_MUST_CHANGE_PASSWORD:     "请先修改密码",
+	ERROR_TOTP_REQUIRED:            "请输入两步验证码",
+	ERROR_TOTP_INVALID:             "两步验证码错误",
+	ERROR_TOTP_NOT_ENROLLED:        "请先绑定两步验证",
+	ERROR_TOTP_RECENT_REQUIRED:     "该操作需要重新进行两步验证",
 
 	ERROR_SEND_EMAIL: "发送邮件失败",
 	ERROR_SAVE_FILE:  "保存文件失败",
 	ERROR_SERVER:     "服务器错误",
 
+	ERROR_CHECK_IMAGE_FORMAT: "图片格式错误",
+	ERROR_CHECK_IMAGE_SIZE:   "图片大小超过限制",
+
 	ERROR_DATABASE: "数据库错误，请上报管理员",
 }
 
@@ -30,6 +30,19 @@ func GetUid(c *gin.Context) string {
 	}
 }
 
+// 当前请求的会话id
+func GetSid(c *gin.Context) string {
+	token := FindToken(c)
+	if token == "" {
+		return ""
+	}
+	claims, err := util.ParseToken(token)
+	if err != nil {
+		return ""
+	}
+	return claims.Sid
+}
+
 // 返回是否没有错误
 func ErrorValid(valid *validation.Validation, errorPhase string) (bool, error) {
 	s := errorPhase
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// 令牌桶，容量为burst，每period补满
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type Rule struct {
+	Action string
+	Burst  int
+	Period time.Duration
+}
+
+func (r Rule) rate() float64 {
+	return float64(r.Burst) / r.Period.Seconds()
+}
+
+// 取出一个令牌，失败时返回需要等待的时间
+func (r Rule) Take(b *Bucket, now time.Time) (bool, time.Duration) {
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = float64(r.Burst)
+	} else if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(r.Burst), b.Tokens+elapsed*r.rate())
+	}
+	b.UpdatedAt = now
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return true, 0
+	}
+	wait := (1 - b.Tokens) / r.rate()
+	return false, time.Duration(math.Ceil(wait)) * time.Second
+}
+
+// 桶是否已经补满，补满的桶可以直接删除
+func (r Rule) Full(b *Bucket, now time.Time) bool {
+	return b.Tokens+now.Sub(b.UpdatedAt).Seconds()*r.rate() >= float64(r.Burst)
+}
+
+type entry struct {
+	rule   Rule
+	bucket Bucket
+}
+
+// 进程内的计数
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*entry
+}
+
+var Memory = &MemoryStore{buckets: map[string]*entry{}}
+
+func key(uid uint64, action string) string {
+	return fmt.Sprintf("%d:%s", uid, action)
+}
+
+func (s *MemoryStore) Take(uid uint64, r Rule) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := key(uid, r.Action)
+	en, ok := s.buckets[k]
+	if !ok {
+		en = &entry{}
+		s.buckets[k] = en
+	}
+	en.rule = r
+	return r.Take(&en.bucket, time.Now())
+}
+
+// 清理已经补满的桶
+func (s *MemoryStore) Sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var cnt int
+	for k, en := range s.buckets {
+		if en.rule.Full(&en.bucket, now) {
+			delete(s.buckets, k)
+			cnt++
+		}
+	}
+	return cnt
+}
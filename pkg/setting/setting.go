@@ -1,6 +1,7 @@
 package setting
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"time"
@@ -16,8 +17,11 @@ type Server struct {
 }
 
 type App struct {
-	JwtSecret       string
+	JwtSecret string
+	// 登录会话(refresh token)的有效小时数
 	TokenExpireTime int
+	// access token的有效分钟数
+	AccessTokenExpireMinutes int
 
 	RuntimeRootPath string
 
@@ -47,6 +51,9 @@ type App struct {
 	// 发贴间隔时间
 	TimeLimit       int
 	EnableTimeLimit bool
+
+	// 每个帖子最多的tag数
+	MaxPostTags int
 }
 
 type Database struct {
@@ -56,6 +63,111 @@ type Database struct {
 	Database string
 	Port     string
 }
+
+func (d *Database) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai",
+		d.Host, d.User, d.Password, d.Database, d.Port)
+}
+
+// 各表的保留天数
+type Retention struct {
+	// 已读消息
+	ReadFloorDays  int
+	ReadReplyDays  int
+	ReadLikeDays   int
+	ReadNoticeDays int
+	// 超过天数的浏览记录聚合为每日计数
+	VisitHistoryDays int
+	TagLogDays       int
+	MessageEventDays int
+	// 未被引用的图片保留的小时数
+	OrphanImageHours int
+	// 每批处理的行数
+	BatchSize int
+}
+
+// 热门帖子排序参数
+type Trending struct {
+	LikeWeight  float64
+	FavWeight   float64
+	FloorWeight float64
+	VisitWeight float64
+	// 时间衰减指数，越大衰减越快
+	Gravity float64
+	// 只计算最近几天的帖子
+	WindowDays int
+}
+
+// 个性化推荐参数
+type Recommend struct {
+	// 候选帖子的天数
+	WindowDays int
+	// 候选帖子的最大数量
+	CandidateLimit int
+	// 用于生成兴趣的最近浏览数
+	HistoryLimit int
+}
+
+// tag热度参数，超管可在后台修改
+type TagHot struct {
+	AddPost   float64 `json:"add_post"`
+	AddFloor  float64 `json:"add_floor"`
+	LikePost  float64 `json:"like_post"`
+	FavPost   float64 `json:"fav_post"`
+	DisPost   float64 `json:"dis_post"`
+	LikeFloor float64 `json:"like_floor"`
+	DisFloor  float64 `json:"dis_floor"`
+	// 每个关注者的热度
+	Follower float64 `json:"follower"`
+	// 衰减半衰期
+	HalfLifeHours float64 `json:"half_life_hours"`
+	// 只计算最近几天的记录
+	WindowDays int `json:"window_days"`
+}
+
+// 接口限流参数
+type RateLimit struct {
+	Enable bool
+	// 计数存储，memory为进程内，database为数据库，多实例部署时使用database
+	Store string
+}
+
+// 重复内容检测参数
+type Duplicate struct {
+	Enable bool
+	// 处理方式，reject拒绝，warn提示，hold提交审核
+	Action string
+	// 海明距离不超过该值视为重复
+	Distance int
+	// 对比用户最近的发布数
+	UserRecentCount int
+	// 对比全站最近几小时的帖子
+	SiteHours int
+	// 少于该字数时只对比自己发布的内容
+	MinLength int
+}
+
+// 后台账号密码策略
+type Password struct {
+	MinLength int
+	// 字母、数字、符号至少包含几种
+	MinKinds int
+	// 连续失败次数达到后锁定
+	MaxFailed   int
+	LockMinutes int
+}
+
+// 后台两步验证
+type Totp struct {
+	// 验证器app中显示的名称
+	Issuer string
+	// 输入密码后完成两步验证的时限
+	ChallengeMinutes int
+	// 敏感操作要求最近几分钟内验证过
+	RecentMinutes int
+	RecoveryCodes int
+}
+
 type Environment struct {
 	DB_DEBUG     string
 	QNHD_REFRESH string
@@ -63,8 +175,71 @@ type Environment struct {
 }
 
 var ServerSetting = &Server{}
-var AppSetting = &App{}
+var AppSetting = &App{
+	MaxPostTags:              3,
+	AccessTokenExpireMinutes: 30,
+}
 var DatabaseSetting = &Database{}
+var RetentionSetting = &Retention{
+	ReadFloorDays:    90,
+	ReadReplyDays:    90,
+	ReadLikeDays:     90,
+	ReadNoticeDays:   90,
+	VisitHistoryDays: 30,
+	TagLogDays:       2,
+	MessageEventDays: 3,
+	OrphanImageHours: 24,
+	BatchSize:        5000,
+}
+var TrendingSetting = &Trending{
+	LikeWeight:  1,
+	FavWeight:   2,
+	FloorWeight: 3,
+	VisitWeight: 0.1,
+	Gravity:     1.5,
+	WindowDays:  7,
+}
+var RecommendSetting = &Recommend{
+	WindowDays:     14,
+	CandidateLimit: 500,
+	HistoryLimit:   200,
+}
+var TagHotSetting = &TagHot{
+	AddPost:       20,
+	AddFloor:      10,
+	LikePost:      4,
+	FavPost:       3,
+	DisPost:       4,
+	LikeFloor:     1,
+	DisFloor:      1,
+	Follower:      1,
+	HalfLifeHours: 24,
+	WindowDays:    7,
+}
+var RateLimitSetting = &RateLimit{
+	Enable: true,
+	Store:  "memory",
+}
+var DuplicateSetting = &Duplicate{
+	Enable:          true,
+	Action:          "warn",
+	Distance:        3,
+	UserRecentCount: 20,
+	SiteHours:       24,
+	MinLength:       10,
+}
+var PasswordSetting = &Password{
+	MinLength:   8,
+	MinKinds:    2,
+	MaxFailed:   5,
+	LockMinutes: 15,
+}
+var TotpSetting = &Totp{
+	Issuer:           "qnhd",
+	ChallengeMinutes: 5,
+	RecentMinutes:    10,
+	RecoveryCodes:    10,
+}
 var EnvironmentSetting = &Environment{}
 
 func setupEnvironment() {
@@ -96,5 +271,45 @@ func Setup() {
 		log.Fatalf("Cfg.MapTo DatabaseSetting err: %v", err)
 	}
 
+	err = Cfg.Section("retention").MapTo(RetentionSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo RetentionSetting err: %v", err)
+	}
+
+	err = Cfg.Section("trending").MapTo(TrendingSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo TrendingSetting err: %v", err)
+	}
+
+	err = Cfg.Section("recommend").MapTo(RecommendSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo RecommendSetting err: %v", err)
+	}
+
+	err = Cfg.Section("tag_hot").MapTo(TagHotSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo TagHotSetting err: %v", err)
+	}
+
+	err = Cfg.Section("rate_limit").MapTo(RateLimitSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo RateLimitSetting err: %v", err)
+	}
+
+	err = Cfg.Section("duplicate").MapTo(DuplicateSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo DuplicateSetting err: %v", err)
+	}
+
+	err = Cfg.Section("password").MapTo(PasswordSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo PasswordSetting err: %v", err)
+	}
+
+	err = Cfg.Section("totp").MapTo(TotpSetting)
+	if err != nil {
+		log.Fatalf("Cfg.MapTo TotpSetting err: %v", err)
+	}
+
 	setupEnvironment()
 }
@@ -0,0 +1,35 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+)
+
+// 计算分词结果的64位SimHash，重复出现的词权重更高
+func Hash(tokens []string) uint64 {
+	var v [64]int
+	for _, t := range tokens {
+		h := fnv.New64a()
+		h.Write([]byte(t))
+		x := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if x&(1<<uint(i)) != 0 {
+				v[i]++
+			} else {
+				v[i]--
+			}
+		}
+	}
+	var hash uint64
+	for i := 0; i < 64; i++ {
+		if v[i] > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+// 两个hash的海明距离
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
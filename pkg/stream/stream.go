@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"qnhd/models"
+	"qnhd/pkg/logging"
+	"qnhd/pkg/setting"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	// 心跳间隔
+	HEARTBEAT = 25 * time.Second
+	// 每个连接的缓冲，满了就丢弃，客户端可以通过Last-Event-ID补回
+	bufferSize = 32
+	// 重连数据库的间隔
+	reconnectInterval = 5 * time.Second
+)
+
+type hub struct {
+	sync.RWMutex
+	subs map[uint64]map[chan models.MessageEvent]bool
+}
+
+var (
+	h = &hub{subs: map[uint64]map[chan models.MessageEvent]bool{}}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+)
+
+// 订阅某个用户的事件，返回取消订阅的函数
+func Subscribe(uid uint64) (<-chan models.MessageEvent, func()) {
+	ch := make(chan models.MessageEvent, bufferSize)
+	h.Lock()
+	if h.subs[uid] == nil {
+		h.subs[uid] = map[chan models.MessageEvent]bool{}
+	}
+	h.subs[uid][ch] = true
+	h.Unlock()
+	return ch, func() {
+		h.Lock()
+		delete(h.subs[uid], ch)
+		if len(h.subs[uid]) == 0 {
+			delete(h.subs, uid)
+		}
+		h.Unlock()
+	}
+}
+
+// 分发给本实例上的连接，uid为0时分发给所有连接
+func dispatch(ev models.MessageEvent) {
+	var recipients map[uint64]bool
+	if ev.Uid == 0 && ev.Targeted {
+		// 指定受众的通知，一次查出在线用户中的接收者
+		h.RLock()
+		var uids []uint64
+		for uid := range h.subs {
+			uids = append(uids, uid)
+		}
+		h.RUnlock()
+		var err error
+		if recipients, err = models.FilterNoticeRecipients(ev.ItemId, uids); err != nil {
+			logging.Error("filter notice recipients error: %v", err)
+			return
+		}
+	}
+	h.RLock()
+	defer h.RUnlock()
+	send := func(chs map[chan models.MessageEvent]bool) {
+		for ch := range chs {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+	if ev.Uid == 0 {
+		for uid, chs := range h.subs {
+			if recipients == nil || recipients[uid] {
+				send(chs)
+			}
+		}
+		return
+	}
+	send(h.subs[ev.Uid])
+}
+
+// 监听数据库的NOTIFY，断开后自动重连
+func listen() {
+	for {
+		if err := listenOnce(); err != nil {
+			logging.Error("message stream listen error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+func listenOnce() error {
+	conn, err := pgx.Connect(ctx, setting.DatabaseSetting.DSN())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if _, err := conn.Exec(ctx, "LISTEN "+models.MESSAGE_EVENT_CHANNEL); err != nil {
+		return err
+	}
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		var ev models.MessageEvent
+		if err := json.Unmarshal([]byte(n.Payload), &ev); err != nil {
+			logging.Error("parse message event error: %v", err)
+			continue
+		}
+		dispatch(ev)
+	}
+}
+
+func Setup() {
+	ctx, cancel = context.WithCancel(context.Background())
+	go listen()
+}
+
+func Close() {
+	cancel()
+}
@@ -6,6 +6,23 @@ import (
 	"strings"
 )
 
+// 模板参数校验错误
+type ArgsError struct {
+	Missing []string `json:"missing"`
+	Unknown []string `json:"unknown"`
+}
+
+func (e *ArgsError) Error() string {
+	var s []string
+	if len(e.Missing) > 0 {
+		s = append(s, fmt.Sprintf("缺少参数: %s", strings.Join(e.Missing, ", ")))
+	}
+	if len(e.Unknown) > 0 {
+		s = append(s, fmt.Sprintf("未知参数: %s", strings.Join(e.Unknown, ", ")))
+	}
+	return strings.Join(s, "; ")
+}
+
 func GeneArgs(keys, values []string) string {
 	var ret []string
 	if len(keys) != len(values) {
@@ -54,3 +71,70 @@ func fillTemplate(temp string, args map[string]string) string {
 	temp = strings.ReplaceAll(temp, "\\>", ">")
 	return temp
 }
+
+// 填充模板，缺少的参数保留原样
+func Render(temp string, args map[string]string) string {
+	return fillTemplate(temp, args)
+}
+
+// 找出模板中的所有参数，忽略转义的\<和\>
+func Placeholders(temp string) []string {
+	var (
+		ret  []string
+		seen = map[string]bool{}
+		rs   = []rune(temp)
+	)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\\' && i+1 < len(rs) && (rs[i+1] == '<' || rs[i+1] == '>') {
+			i++
+			continue
+		}
+		if rs[i] != '<' {
+			continue
+		}
+		j := i + 1
+		for j < len(rs) && isArgRune(rs[j]) {
+			j++
+		}
+		if j < len(rs) && rs[j] == '>' && j > i+1 {
+			name := string(rs[i+1 : j])
+			if !seen[name] {
+				seen[name] = true
+				ret = append(ret, name)
+			}
+			i = j
+		}
+	}
+	return ret
+}
+
+func isArgRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// 校验模板是否恰好包含所需参数
+func Validate(temp string, args []string) error {
+	var (
+		e      = &ArgsError{}
+		exists = map[string]bool{}
+		need   = map[string]bool{}
+	)
+	for _, p := range Placeholders(temp) {
+		exists[p] = true
+	}
+	for _, a := range args {
+		need[a] = true
+		if !exists[a] {
+			e.Missing = append(e.Missing, a)
+		}
+	}
+	for _, p := range Placeholders(temp) {
+		if !need[p] {
+			e.Unknown = append(e.Unknown, p)
+		}
+	}
+	if len(e.Missing) > 0 || len(e.Unknown) > 0 {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"qnhd/pkg/file"
+	"qnhd/pkg/setting"
+	"strings"
+)
+
+const (
+	FORMAT_JPEG = "jpeg"
+	FORMAT_PNG  = "png"
+	FORMAT_GIF  = "gif"
+)
+
+// 解码前限制像素数，防止解压炸弹
+const maxImagePixels = 40000000
+
+// 生成的尺寸，按最长边缩放
+var imageSizes = []struct {
+	Name    string
+	MaxSide int
+}{
+	{"thumb", 200},
+	{"medium", 800},
+}
+
+type ProcessedImage struct {
+	Hash   string
+	Format string
+	Width  int
+	Height int
+	// 去除EXIF后的原图
+	Original []byte
+	// 各尺寸的图片
+	Sizes map[string][]byte
+}
+
+// 保存后的地址
+type ImageUrls struct {
+	Url       string `json:"url"`
+	ThumbUrl  string `json:"thumb_url"`
+	MediumUrl string `json:"medium_url"`
+}
+
+func CheckImageExt(fileName string) bool {
+	ext := strings.ToLower(file.GetExt(fileName))
+	for _, allow := range setting.AppSetting.ImageAllowExts {
+		if strings.ToLower(allow) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func CheckImageSize(size int) bool {
+	return size <= setting.AppSetting.ImageMaxSize
+}
+
+// 根据文件头判断格式
+func DetectFormat(data []byte) (string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return FORMAT_JPEG, true
+	case bytes.HasPrefix(data, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}):
+		return FORMAT_PNG, true
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return FORMAT_GIF, true
+	}
+	return "", false
+}
+
+func HashImage(data []byte) string {
+	m := md5.Sum(data)
+	return hex.EncodeToString(m[:])
+}
+
+// 校验并处理图片，重新编码以去除EXIF等元数据
+func ProcessImage(data []byte) (*ProcessedImage, error) {
+	format, ok := DetectFormat(data)
+	if !ok {
+		return nil, fmt.Errorf("不支持的图片格式")
+	}
+	cfg, decoded, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decoded != format {
+		return nil, fmt.Errorf("图片内容与格式不符")
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, fmt.Errorf("图片尺寸过大")
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("图片解码失败")
+	}
+	if format == FORMAT_JPEG {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	p := &ProcessedImage{
+		Hash:   HashImage(data),
+		Format: format,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+		Sizes:  map[string][]byte{},
+	}
+	if format == FORMAT_GIF {
+		// gif没有EXIF，保留动图
+		p.Original = data
+	} else if p.Original, err = encodeImage(img, format); err != nil {
+		return nil, err
+	}
+	for _, s := range imageSizes {
+		// 缩略图统一为静态图
+		sizeFormat := format
+		if format == FORMAT_GIF {
+			sizeFormat = FORMAT_PNG
+		}
+		b, err := encodeImage(resizeImage(img, s.MaxSide), sizeFormat)
+		if err != nil {
+			return nil, err
+		}
+		p.Sizes[s.Name] = b
+	}
+	return p, nil
+}
+
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FORMAT_JPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	case FORMAT_PNG:
+		err = png.Encode(&buf, img)
+	case FORMAT_GIF:
+		err = gif.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("不支持的图片格式")
+	}
+	return buf.Bytes(), err
+}
+
+func formatExt(format string) string {
+	if format == FORMAT_JPEG {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// 保存图片，按hash前两位分目录
+func SaveImage(p *ProcessedImage) (ImageUrls, error) {
+	var urls ImageUrls
+	dir := p.Hash[:2]
+	if err := file.IsNotExistMkDir(filepath.Join(setting.AppSetting.ImageSavePath, dir)); err != nil {
+		return urls, err
+	}
+	prefix := strings.TrimSuffix(setting.AppSetting.ImagePrefixUrl, "/")
+	save := func(name string, data []byte) (string, error) {
+		rel := dir + "/" + name
+		if err := ioutil.WriteFile(filepath.Join(setting.AppSetting.ImageSavePath, rel), data, 0644); err != nil {
+			return "", err
+		}
+		return prefix + "/" + rel, nil
+	}
+	var err error
+	if urls.Url, err = save(p.Hash+formatExt(p.Format), p.Original); err != nil {
+		return urls, err
+	}
+	sizeExt := formatExt(p.Format)
+	if p.Format == FORMAT_GIF {
+		sizeExt = formatExt(FORMAT_PNG)
+	}
+	if urls.ThumbUrl, err = save(p.Hash+"_thumb"+sizeExt, p.Sizes["thumb"]); err != nil {
+		return urls, err
+	}
+	if urls.MediumUrl, err = save(p.Hash+"_medium"+sizeExt, p.Sizes["medium"]); err != nil {
+		return urls, err
+	}
+	return urls, nil
+}
+
+// 根据地址删除保存的图片
+func RemoveImage(url string) error {
+	if url == "" {
+		return nil
+	}
+	prefix := strings.TrimSuffix(setting.AppSetting.ImagePrefixUrl, "/") + "/"
+	if !strings.HasPrefix(url, prefix) {
+		return fmt.Errorf("非本站图片: %s", url)
+	}
+	err := os.Remove(filepath.Join(setting.AppSetting.ImageSavePath, filepath.FromSlash(strings.TrimPrefix(url, prefix))))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// 按最长边等比缩小，取区域平均值
+func resizeImage(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return src
+	}
+	nw, nh := maxSide, h*maxSide/w
+	if h > w {
+		nw, nh = w*maxSide/h, maxSide
+	}
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, nw, nh))
+	for y := 0; y < nh; y++ {
+		y0, y1 := b.Min.Y+y*h/nh, b.Min.Y+(y+1)*h/nh
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < nw; x++ {
+			x0, x1 := b.Min.X+x*w/nw, b.Min.X+(x+1)*w/nw
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
+
+// 读取jpeg中EXIF的方向，没有时返回1
+func jpegOrientation(data []byte) int {
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		size := int(data[i+2])<<8 | int(data[i+3])
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var u16 func([]byte) int
+	var u32 func([]byte) int
+	switch string(tiff[:2]) {
+	case "II":
+		u16 = func(b []byte) int { return int(b[0]) | int(b[1])<<8 }
+		u32 = func(b []byte) int { return u16(b) | u16(b[2:])<<16 }
+	case "MM":
+		u16 = func(b []byte) int { return int(b[0])<<8 | int(b[1]) }
+		u32 = func(b []byte) int { return u16(b)<<16 | u16(b[2:]) }
+	default:
+		return 1
+	}
+	ifd := u32(tiff[4:])
+	if ifd < 0 || ifd+2 > len(tiff) {
+		return 1
+	}
+	n := u16(tiff[ifd:])
+	for k := 0; k < n; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			break
+		}
+		if u16(tiff[e:]) == 0x0112 {
+			return u16(tiff[e+8:])
+		}
+	}
+	return 1
+}
+
+// 按EXIF方向旋转翻转
+func applyOrientation(src image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
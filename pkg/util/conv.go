@@ -31,3 +31,12 @@ func AsStrU(a uint64) string {
 func AsStr(a int) string {
 	return fmt.Sprintf("%d", a)
 }
+
+// string数组转uint64数组
+func AsUints(a []string) []uint64 {
+	var b []uint64
+	for _, s := range a {
+		b = append(b, AsUint(s))
+	}
+	return b
+}
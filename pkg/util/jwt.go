@@ -16,14 +16,18 @@ var (
 
 type Claims struct {
 	Uid string `json:"uid"`
+	// 登录会话id，用于注销
+	Sid string `json:"sid"`
 	jwt.StandardClaims
 }
 
-func GenerateToken(uid string) (string, error) {
+// 生成短期的access token
+func GenerateToken(uid, sid string) (string, error) {
 	nowTime := time.Now()
-	expireTime := nowTime.Add(time.Duration(setting.AppSetting.TokenExpireTime) * time.Hour)
+	expireTime := nowTime.Add(time.Duration(setting.AppSetting.AccessTokenExpireMinutes) * time.Minute)
 	claims := Claims{
 		uid,
+		sid,
 		jwt.StandardClaims{
 			ExpiresAt: expireTime.Unix(),
 			Issuer:    "qnhd",
@@ -34,6 +38,35 @@ func GenerateToken(uid string) (string, error) {
 	return token, err
 }
 
+// 两步验证用的临时token，没有会话，不能访问接口
+const totpTokenSubject = "totp"
+
+// 生成输入密码后进行两步验证用的token
+func GenerateTotpToken(uid string) (string, error) {
+	expireTime := time.Now().Add(time.Duration(setting.TotpSetting.ChallengeMinutes) * time.Minute)
+	claims := Claims{
+		Uid: uid,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expireTime.Unix(),
+			Issuer:    "qnhd",
+			Subject:   totpTokenSubject,
+		},
+	}
+	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return tokenClaims.SignedString(jwtSecret)
+}
+
+func ParseTotpToken(token string) (string, error) {
+	claims, err := ParseToken(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.Subject != totpTokenSubject || claims.Sid != "" {
+		return "", ErrInvalidToken
+	}
+	return claims.Uid, nil
+}
+
 func ParseToken(token string) (*Claims, error) {
 	tokenClaims, err := jwt.ParseWithClaims(token, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		_, ok := token.Method.(*jwt.SigningMethodHMAC)
@@ -0,0 +1,118 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"qnhd/pkg/setting"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id参数
+const (
+	argonTime    = 1
+	argonMemory  = 64 * 1024
+	argonThreads = 2
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+const argonPrefix = "$argon2id$"
+
+// 生成argon2id的hash，格式为 $argon2id$v=19$m=65536,t=1,p=2$salt$hash
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s", argonPrefix, argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func IsPasswordHashed(stored string) bool {
+	return strings.HasPrefix(stored, argonPrefix)
+}
+
+// 校验密码，返回是否正确以及是否需要重新生成hash
+// 没有hash过的旧密码按明文比较
+func CheckPassword(stored, password string) (bool, bool) {
+	if stored == "" {
+		return false, false
+	}
+	if !IsPasswordHashed(stored) {
+		ok := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false
+	}
+	other := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false
+	}
+	// 参数变化后重新生成
+	rehash := version != argon2.Version || memory != argonMemory || time != argonTime || threads != argonThreads
+	return true, rehash
+}
+
+// 检查密码强度
+func CheckPasswordPolicy(password string) error {
+	p := setting.PasswordSetting
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("密码长度不能少于%d位", p.MinLength)
+	}
+	var letter, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+	kinds := 0
+	for _, b := range []bool{letter, digit, other} {
+		if b {
+			kinds++
+		}
+	}
+	if kinds < p.MinKinds {
+		return fmt.Errorf("密码需要包含字母、数字、符号中的至少%d种", p.MinKinds)
+	}
+	return nil
+}
+
+// 生成临时密码
+func RandomPassword() (string, error) {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	// 保证同时有字母数字和符号
+	return base64.RawURLEncoding.EncodeToString(b) + "a1_", nil
+}